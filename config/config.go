@@ -63,13 +63,17 @@ func InitDB() {
 		&models.User{},
 		&models.Team{},
 		&models.TeamMember{},
+		&models.TeamInvitation{},
 		&models.Project{},
 		&models.Page{},
 		&models.Element{},
+		&models.ElementLock{},
+		&models.Component{},
 		&models.Revision{},
 		&models.Comment{},
 		&models.CommentReply{},
 		&models.Session{},
+		&models.SocketTicket{},
 		&models.Template{},
 	)
 	if err != nil {
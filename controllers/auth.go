@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"website-builder/models"
 	"website-builder/utils"
+	ws "website-builder/websocket"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
@@ -11,11 +12,12 @@ import (
 )
 
 type AuthController struct {
-	db *gorm.DB
+	db  *gorm.DB
+	hub *ws.Hub
 }
 
-func NewAuthController(db *gorm.DB) *AuthController {
-	return &AuthController{db: db}
+func NewAuthController(db *gorm.DB, hub *ws.Hub) *AuthController {
+	return &AuthController{db: db, hub: hub}
 }
 
 type LoginInput struct {
@@ -27,6 +29,8 @@ type RegisterInput struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
 	FullName string `json:"full_name" binding:"required"`
+	// InvitationToken optionally joins the new account to the inviting team
+	InvitationToken string `json:"invitation_token"`
 }
 
 func (ac *AuthController) Login(c *gin.Context) {
@@ -92,11 +96,31 @@ func (ac *AuthController) Register(c *gin.Context) {
 		FullName: input.FullName,
 	}
 
-	if err := ac.db.Create(&user).Error; err != nil {
+	var invitation *models.TeamInvitation
+	err = ac.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if input.InvitationToken == "" {
+			return nil
+		}
+		var err error
+		invitation, err = acceptInvitation(tx, input.InvitationToken, user)
+		return err
+	})
+	if err != nil {
+		if input.InvitationToken != "" {
+			respondInvitationError(c, err)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
+	if invitation != nil {
+		ac.hub.Publish(ws.TeamRoom(invitation.TeamID), "member_added", gin.H{"user_id": user.ID, "role": invitation.Role})
+	}
+
 	token, err := utils.GenerateJWT(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"website-builder/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DeletedRetention is how long soft-deleted rows are kept before they
+	// are purged for good.
+	DeletedRetention = 30 * 24 * time.Hour
+	// purgeInterval is how often expired rows are purged.
+	purgeInterval = time.Hour
+)
+
+// deleteElements soft-deletes elements together with their comments and
+// drops any locks held on them.
+func deleteElements(tx *gorm.DB, elementIDs []string) error {
+	if len(elementIDs) == 0 {
+		return nil
+	}
+	if err := tx.Where("element_id IN ?", elementIDs).Delete(&models.ElementLock{}).Error; err != nil {
+		return err
+	}
+	comments := tx.Model(&models.Comment{}).Select("id").Where("element_id IN ?", elementIDs)
+	if err := tx.Where("comment_id IN (?)", comments).Delete(&models.CommentReply{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("element_id IN ?", elementIDs).Delete(&models.Comment{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.Element{}, "id IN ?", elementIDs).Error
+}
+
+// deleteProjects soft-deletes projects and everything under them: pages,
+// elements, comments, components and revisions. Live sessions are dropped
+// outright.
+func deleteProjects(tx *gorm.DB, projectIDs []string) error {
+	if len(projectIDs) == 0 {
+		return nil
+	}
+
+	var elementIDs []string
+	if err := tx.Model(&models.Element{}).
+		Joins("JOIN page ON page.id = element.page_id").
+		Where("page.project_id IN ?", projectIDs).
+		Pluck("element.id", &elementIDs).Error; err != nil {
+		return err
+	}
+	if err := deleteElements(tx, elementIDs); err != nil {
+		return err
+	}
+
+	if err := tx.Where("project_id IN ?", projectIDs).Delete(&models.Page{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("project_id IN ?", projectIDs).Delete(&models.Component{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("project_id IN ?", projectIDs).Delete(&models.Revision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("project_id IN ?", projectIDs).Delete(&models.Session{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.Project{}, "id IN ?", projectIDs).Error
+}
+
+// deleteTeam soft-deletes a team, its memberships and all of its projects.
+// Pending invitations are dropped outright.
+func deleteTeam(tx *gorm.DB, teamID string) error {
+	var projectIDs []string
+	if err := tx.Model(&models.Project{}).Where("team_id = ?", teamID).Pluck("id", &projectIDs).Error; err != nil {
+		return err
+	}
+	if err := deleteProjects(tx, projectIDs); err != nil {
+		return err
+	}
+
+	if err := tx.Where("team_id = ?", teamID).Delete(&models.TeamInvitation{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("team_id = ?", teamID).Delete(&models.TeamMember{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.Team{}, "id = ?", teamID).Error
+}
+
+// PurgeDeleted periodically removes rows that were soft-deleted more than
+// DeletedRetention ago.
+func PurgeDeleted(db *gorm.DB) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeDeleted(db, time.Now().Add(-DeletedRetention))
+		<-ticker.C
+	}
+}
+
+// purgeDeleted hard-deletes rows soft-deleted before cutoff, children
+// first so nothing is left pointing at a purged parent.
+func purgeDeleted(db *gorm.DB, cutoff time.Time) {
+	tables := []interface{}{
+		&models.CommentReply{},
+		&models.Comment{},
+		&models.Element{},
+		&models.Page{},
+		&models.Component{},
+		&models.Revision{},
+		&models.Session{},
+		&models.Project{},
+		&models.TeamMember{},
+		&models.Team{},
+	}
+
+	for _, table := range tables {
+		result := db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Delete(table)
+		if result.Error != nil {
+			log.Printf("Failed to purge deleted %T: %v", table, result.Error)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Purged %d deleted %T rows", result.RowsAffected, table)
+		}
+	}
+}
@@ -0,0 +1,598 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"website-builder/elements"
+	"website-builder/models"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ComponentController struct {
+	db  *gorm.DB
+	hub *ws.Hub
+}
+
+func NewComponentController(db *gorm.DB, hub *ws.Hub) *ComponentController {
+	return &ComponentController{db: db, hub: hub}
+}
+
+// ComponentUpdate is broadcast when a component's master changes so every
+// open editor can redraw its instances.
+type ComponentUpdate struct {
+	Component *models.Component `json:"component"`
+	// Instances lists the elements that place the component.
+	Instances []string `json:"instances"`
+}
+
+func (cc *ComponentController) notifyProject(projectID string, event string, data interface{}) {
+	cc.hub.Publish(ws.ProjectRoom(projectID), event, data)
+}
+
+// CreateComponent defines a component either from explicit elements or by
+// copying the subtree of an existing element. With replace set the
+// original subtree is swapped for an instance of the new component.
+func (cc *ComponentController) CreateComponent(c *gin.Context) {
+	projectID := c.Param("id")
+
+	var input struct {
+		Name      string                `json:"name" binding:"required,max=100"`
+		ElementID string                `json:"element_id"`
+		Elements  models.ComponentNodes `json:"elements"`
+		Replace   bool                  `json:"replace"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (input.ElementID == "") == (len(input.Elements) == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "either element_id or elements is required"})
+		return
+	}
+	if input.Replace && input.ElementID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "replace requires element_id"})
+		return
+	}
+
+	userID := c.GetString("userID")
+	component := models.Component{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Name:      strings.TrimSpace(input.Name),
+		Elements:  input.Elements,
+		Version:   1,
+	}
+
+	var batch *ElementBatch
+	err := cc.db.Transaction(func(tx *gorm.DB) error {
+		var source []models.Element
+		if input.ElementID != "" {
+			var root models.Element
+			if err := tx.Select("id", "page_id").First(&root, "id = ?", input.ElementID).Error; err != nil {
+				return notFoundOr(err, "element not found")
+			}
+			var page models.Page
+			if err := tx.Select("id", "project_id").First(&page, "id = ?", root.PageID).Error; err != nil {
+				return notFoundOr(err, "page not found")
+			}
+			if page.ProjectID != projectID {
+				return ws.NewError(ws.ErrBadRequest, "element belongs to another project")
+			}
+
+			var err error
+			if source, err = loadSubtree(tx, root.PageID, root.ID); err != nil {
+				return err
+			}
+			component.Elements = componentNodes(source)
+		}
+
+		width, height, err := normalizeNodes(component.Elements)
+		if err != nil {
+			return err
+		}
+		component.Width, component.Height = width, height
+		if err := tx.Create(&component).Error; err != nil {
+			return err
+		}
+
+		if !input.Replace {
+			return nil
+		}
+		root := source[0]
+		batch = newElementBatch(userID, root.PageID, "rest:"+userID)
+		batch.ProjectID = projectID
+		if _, err := batch.apply(tx, &ElementOperation{Op: OpDelete, ElementID: root.ID}); err != nil {
+			return err
+		}
+		_, err = batch.apply(tx, &ElementOperation{
+			Op:              OpCreate,
+			Type:            models.ComponentElement,
+			Data:            models.JSON{"component_id": component.ID},
+			PositionX:       &root.PositionX,
+			PositionY:       &root.PositionY,
+			Width:           &root.Width,
+			Height:          &root.Height,
+			ZIndex:          &root.ZIndex,
+			ParentElementID: root.ParentElementID,
+		})
+		return err
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create component")
+		return
+	}
+
+	cc.notifyProject(projectID, "component.created", component)
+	if batch != nil {
+		publishBatch(cc.hub, batch)
+	}
+	c.JSON(http.StatusCreated, component)
+}
+
+// GetComponents lists a project's components by name
+func (cc *ComponentController) GetComponents(c *gin.Context) {
+	var components []models.Component
+	if err := cc.db.Where("project_id = ?", c.Param("id")).
+		Order("name").Find(&components).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch components"})
+		return
+	}
+
+	c.JSON(http.StatusOK, components)
+}
+
+func (cc *ComponentController) GetComponent(c *gin.Context) {
+	var component models.Component
+	if err := cc.db.First(&component, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Component not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, component)
+}
+
+// UpdateComponent renames a component or replaces its elements. New
+// elements reach every instance at once; overrides of elements that were
+// removed, or whose type changed, are dropped from the instances.
+func (cc *ComponentController) UpdateComponent(c *gin.Context) {
+	var input struct {
+		Name     *string               `json:"name" binding:"omitempty,max=100"`
+		Elements models.ComponentNodes `json:"elements"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("userID")
+	var component models.Component
+	var instances []models.Element
+	batches := map[string]*ElementBatch{}
+	err := cc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&component, "id = ?", c.Param("id")).Error; err != nil {
+			return notFoundOr(err, "component not found")
+		}
+
+		if input.Name != nil {
+			name := strings.TrimSpace(*input.Name)
+			if name == "" {
+				return ws.NewError(ws.ErrBadRequest, "name cannot be empty")
+			}
+			component.Name = name
+		}
+
+		var err error
+		if instances, err = componentInstances(tx, component.ProjectID, component.ID); err != nil {
+			return err
+		}
+
+		previous := nodeTypes(component.Elements)
+		if input.Elements != nil {
+			width, height, err := normalizeNodes(input.Elements)
+			if err != nil {
+				return err
+			}
+			component.Elements = input.Elements
+			component.Width, component.Height = width, height
+			component.Version++
+		}
+		// Saved first so instances are checked against the new elements
+		if err := tx.Save(&component).Error; err != nil {
+			return err
+		}
+
+		if input.Elements != nil {
+			current := nodeTypes(component.Elements)
+			for _, instance := range instances {
+				overrides, ok := instance.Data["overrides"].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				kept := make(map[string]interface{}, len(overrides))
+				for nodeID, patch := range overrides {
+					if nodeType, ok := current[nodeID]; ok && nodeType == previous[nodeID] {
+						kept[nodeID] = patch
+					}
+				}
+				if len(kept) == len(overrides) {
+					continue
+				}
+
+				batch, ok := batches[instance.PageID]
+				if !ok {
+					batch = newElementBatch(userID, instance.PageID, "rest:"+userID)
+					batch.ProjectID = component.ProjectID
+					batches[instance.PageID] = batch
+				}
+				if _, err := batch.apply(tx, &ElementOperation{
+					Op:        OpUpdate,
+					ElementID: instance.ID,
+					Data:      models.JSON{"overrides": kept},
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update component")
+		return
+	}
+
+	for _, batch := range batches {
+		publishBatch(cc.hub, batch)
+	}
+	update := ComponentUpdate{Component: &component, Instances: make([]string, 0, len(instances))}
+	for _, instance := range instances {
+		update.Instances = append(update.Instances, instance.ID)
+	}
+	cc.notifyProject(component.ProjectID, "component.updated", update)
+	c.JSON(http.StatusOK, component)
+}
+
+// DeleteComponent deletes a component that is no longer placed anywhere.
+func (cc *ComponentController) DeleteComponent(c *gin.Context) {
+	var component models.Component
+	err := cc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&component, "id = ?", c.Param("id")).Error; err != nil {
+			return notFoundOr(err, "component not found")
+		}
+
+		instances, err := componentInstances(tx, component.ProjectID, component.ID)
+		if err != nil {
+			return err
+		}
+		if len(instances) > 0 {
+			return ws.NewError(ws.ErrConflict,
+				fmt.Sprintf("component is placed %d times; delete or detach its instances first", len(instances)))
+		}
+		return tx.Delete(&component).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to delete component")
+		return
+	}
+
+	cc.notifyProject(component.ProjectID, "component.deleted", gin.H{"component_id": component.ID})
+	c.JSON(http.StatusOK, gin.H{"message": "Component deleted successfully"})
+}
+
+// DetachInstance turns a component instance into plain elements: the
+// component's elements, with the instance's overrides applied, are copied
+// into the instance's place and the instance is removed.
+func (cc *ComponentController) DetachInstance(c *gin.Context) {
+	var instance models.Element
+	if err := cc.db.Select("id", "page_id").First(&instance, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Element not found"})
+		return
+	}
+
+	userID := c.GetString("userID")
+	result := &ElementCopy{IDs: map[string]string{}}
+	var err error
+	result.Batch, err = runChangeSet(cc.db, cc.hub, userID, "", instance.PageID, "rest:"+userID, func(tx *gorm.DB, batch *ElementBatch) error {
+		if err := tx.First(&instance, "id = ?", instance.ID).Error; err != nil {
+			return notFoundOr(err, "element not found")
+		}
+		if instance.Type != models.ComponentElement {
+			return ws.NewError(ws.ErrBadRequest, "only component instances can be detached")
+		}
+
+		var component models.Component
+		if err := tx.First(&component, "id = ? AND project_id = ?",
+			elements.DataString(instance.Data, "component_id", ""), batch.ProjectID).Error; err != nil {
+			return notFoundOr(err, "component not found")
+		}
+
+		// Root elements are stacked where the instance was, in their order
+		// within the component
+		var roots []models.ComponentNode
+		pairs := make([]string, 0, 2*len(component.Elements))
+		for _, node := range component.Elements {
+			result.IDs[node.ID] = uuid.New().String()
+			pairs = append(pairs, node.ID, result.IDs[node.ID])
+			if node.ParentElementID == nil {
+				roots = append(roots, node)
+			}
+		}
+		sort.SliceStable(roots, func(i, j int) bool { return roots[i].ZIndex < roots[j].ZIndex })
+		rootZ := make(map[string]int, len(roots))
+		for i, root := range roots {
+			rootZ[root.ID] = instance.ZIndex + i
+		}
+		references := strings.NewReplacer(pairs...)
+		overrides, _ := instance.Data["overrides"].(map[string]interface{})
+
+		for i := range component.Elements {
+			node := component.Elements[i]
+			patch, _ := overrides[node.ID].(map[string]interface{})
+			op := &ElementOperation{
+				Op:        OpCreate,
+				ElementID: result.IDs[node.ID],
+				Type:      node.Type,
+				Data:      remapReferences(models.ApplyOverride(node.Data, patch), references).(models.JSON),
+				PositionX: &node.PositionX,
+				PositionY: &node.PositionY,
+				Width:     &node.Width,
+				Height:    &node.Height,
+				ZIndex:    &node.ZIndex,
+			}
+			if node.ParentElementID == nil {
+				x, y, z := instance.PositionX+node.PositionX, instance.PositionY+node.PositionY, rootZ[node.ID]
+				op.PositionX, op.PositionY, op.ZIndex = &x, &y, &z
+				op.ParentElementID = instance.ParentElementID
+			} else {
+				parent := result.IDs[*node.ParentElementID]
+				op.ParentElementID = &parent
+			}
+			if _, err := batch.apply(tx, op); err != nil {
+				return err
+			}
+		}
+		if len(roots) > 0 {
+			result.ElementID = result.IDs[roots[0].ID]
+		}
+
+		_, err := batch.apply(tx, &ElementOperation{Op: OpDelete, ElementID: instance.ID})
+		return err
+	})
+	if err != nil {
+		respondError(c, err, "Failed to detach instance")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// componentNodes copies an element subtree, as returned by loadSubtree,
+// into component nodes with fresh IDs. The root loses its parent.
+func componentNodes(subtree []models.Element) models.ComponentNodes {
+	ids := make(map[string]string, len(subtree))
+	pairs := make([]string, 0, 2*len(subtree))
+	for _, element := range subtree {
+		ids[element.ID] = uuid.New().String()
+		pairs = append(pairs, element.ID, ids[element.ID])
+	}
+	references := strings.NewReplacer(pairs...)
+
+	nodes := make(models.ComponentNodes, 0, len(subtree))
+	for i, element := range subtree {
+		node := models.ComponentNode{
+			ID:        ids[element.ID],
+			Type:      element.Type,
+			Data:      remapReferences(element.Data, references).(models.JSON),
+			PositionX: element.PositionX,
+			PositionY: element.PositionY,
+			Width:     element.Width,
+			Height:    element.Height,
+			ZIndex:    element.ZIndex,
+		}
+		if i > 0 {
+			parent := ids[*element.ParentElementID]
+			node.ParentElementID = &parent
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// normalizeNodes validates a component's elements and puts them in the
+// form they are stored in: every node has a UUID, parents come before their
+// children and the root nodes' bounding box starts at 0,0. It returns the
+// size of that box.
+func normalizeNodes(nodes models.ComponentNodes) (int, int, error) {
+	if len(nodes) == 0 {
+		return 0, 0, ws.NewError(ws.ErrBadRequest, "a component needs at least one element")
+	}
+	if len(nodes) > maxBatchOperations {
+		return 0, 0, ws.NewError(ws.ErrBadRequest, fmt.Sprintf("a component can have at most %d elements", maxBatchOperations))
+	}
+
+	// IDs must stay stable across updates since overrides refer to them,
+	// so client-chosen ones are kept but must be UUIDs
+	byID := make(map[string]int, len(nodes))
+	for i := range nodes {
+		if nodes[i].ID == "" {
+			nodes[i].ID = uuid.New().String()
+		} else if !isUUID(nodes[i].ID) {
+			return 0, 0, ws.NewError(ws.ErrBadRequest, fmt.Sprintf("elements[%d].id must be a UUID", i))
+		}
+		if _, taken := byID[nodes[i].ID]; taken {
+			return 0, 0, ws.NewError(ws.ErrBadRequest, "element id "+nodes[i].ID+" is used twice")
+		}
+		byID[nodes[i].ID] = i
+	}
+
+	var errs []elements.FieldError
+	for i := range nodes {
+		node := &nodes[i]
+		path := fmt.Sprintf("elements[%d]", i)
+		if node.Type == models.ComponentElement {
+			return 0, 0, ws.NewError(ws.ErrBadRequest, "components cannot contain component instances")
+		}
+		elementType, ok := elements.Lookup(string(node.Type))
+		if !ok {
+			return 0, 0, ws.NewError(ws.ErrBadRequest, "unknown element type "+string(node.Type))
+		}
+		if node.ParentElementID != nil {
+			if _, ok := byID[*node.ParentElementID]; !ok {
+				return 0, 0, ws.NewError(ws.ErrBadRequest, path+": parent element is not part of the component")
+			}
+		}
+
+		data := elementType.DefaultData()
+		for key, value := range node.Data {
+			data[key] = value
+		}
+		node.Data = data
+		errs = append(errs, prefixFieldErrors(elements.Validate(string(node.Type), node.Data), path+".data.")...)
+	}
+	if len(errs) > 0 {
+		return 0, 0, &ws.Error{Code: ws.ErrValidation, Message: "invalid component elements", Details: errs}
+	}
+
+	// Order parents before children; whatever is not reached from a root
+	// sits on a cycle
+	children := make(map[string][]int, len(nodes))
+	var queue []int
+	for i, node := range nodes {
+		if node.ParentElementID == nil {
+			queue = append(queue, i)
+		} else {
+			children[*node.ParentElementID] = append(children[*node.ParentElementID], i)
+		}
+	}
+	ordered := make(models.ComponentNodes, 0, len(nodes))
+	for len(queue) > 0 {
+		node := nodes[queue[0]]
+		queue = append(queue[1:], children[node.ID]...)
+		ordered = append(ordered, node)
+	}
+	if len(ordered) != len(nodes) {
+		return 0, 0, ws.NewError(ws.ErrBadRequest, "component elements must form a tree")
+	}
+	copy(nodes, ordered)
+
+	minX, minY, maxX, maxY := 0, 0, 0, 0
+	first := true
+	for _, node := range nodes {
+		if node.ParentElementID != nil {
+			continue
+		}
+		if first {
+			minX, minY = node.PositionX, node.PositionY
+			maxX, maxY = node.PositionX+node.Width, node.PositionY+node.Height
+			first = false
+			continue
+		}
+		minX, minY = min(minX, node.PositionX), min(minY, node.PositionY)
+		maxX, maxY = max(maxX, node.PositionX+node.Width), max(maxY, node.PositionY+node.Height)
+	}
+	for i := range nodes {
+		if nodes[i].ParentElementID == nil {
+			nodes[i].PositionX -= minX
+			nodes[i].PositionY -= minY
+		}
+	}
+	return maxX - minX, maxY - minY, nil
+}
+
+// checkInstance makes sure a component instance places a component of the
+// page's project and that its overrides leave every overridden element
+// valid.
+func checkInstance(tx *gorm.DB, projectID string, element *models.Element) error {
+	var component models.Component
+	err := tx.First(&component, "id = ? AND project_id = ?",
+		elements.DataString(element.Data, "component_id", ""), projectID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &ws.Error{Code: ws.ErrValidation, Message: "invalid element data", Details: []elements.FieldError{
+			{Field: "component_id", Message: "must be a component of this project"},
+		}}
+	}
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[string]models.ComponentNode, len(component.Elements))
+	for _, node := range component.Elements {
+		nodes[node.ID] = node
+	}
+
+	var errs []elements.FieldError
+	overrides, _ := element.Data["overrides"].(map[string]interface{})
+	for nodeID, value := range overrides {
+		path := "overrides." + nodeID
+		node, ok := nodes[nodeID]
+		if !ok {
+			errs = append(errs, elements.FieldError{Field: path, Message: "is not an element of the component"})
+			continue
+		}
+		patch, ok := value.(map[string]interface{})
+		if !ok {
+			errs = append(errs, elements.FieldError{Field: path, Message: "must be an object"})
+			continue
+		}
+		errs = append(errs, prefixFieldErrors(elements.Validate(string(node.Type), models.ApplyOverride(node.Data, patch)), path+".")...)
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		return &ws.Error{Code: ws.ErrValidation, Message: "invalid element data", Details: errs}
+	}
+	return nil
+}
+
+// componentInstances returns the elements of a project that place
+// componentID.
+func componentInstances(tx *gorm.DB, projectID string, componentID string) ([]models.Element, error) {
+	var candidates []models.Element
+	if err := tx.Model(&models.Element{}).
+		Joins("JOIN page ON page.id = element.page_id AND page.deleted_at IS NULL").
+		Where("page.project_id = ? AND element.type = ?", projectID, models.ComponentElement).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	instances := make([]models.Element, 0, len(candidates))
+	for _, candidate := range candidates {
+		if elements.DataString(candidate.Data, "component_id", "") == componentID {
+			instances = append(instances, candidate)
+		}
+	}
+	return instances, nil
+}
+
+func nodeTypes(nodes models.ComponentNodes) map[string]models.ElementType {
+	types := make(map[string]models.ElementType, len(nodes))
+	for _, node := range nodes {
+		types[node.ID] = node.Type
+	}
+	return types
+}
+
+// prefixFieldErrors returns the field errors of a validation failure with
+// prefix put in front of every path.
+func prefixFieldErrors(err error, prefix string) []elements.FieldError {
+	var invalid *elements.ValidationError
+	if !errors.As(err, &invalid) {
+		return nil
+	}
+	errs := make([]elements.FieldError, 0, len(invalid.Errors))
+	for _, fieldErr := range invalid.Errors {
+		errs = append(errs, elements.FieldError{Field: prefix + fieldErr.Field, Message: fieldErr.Message})
+	}
+	return errs
+}
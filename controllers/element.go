@@ -3,32 +3,37 @@ package controllers
 import (
 	"net/http"
 
+	"website-builder/elements"
 	"website-builder/models"
+	"website-builder/policy"
+	ws "website-builder/websocket"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type ElementController struct {
-	db *gorm.DB
+	db     *gorm.DB
+	hub    *ws.Hub
+	policy *policy.Policy
 }
 
-func NewElementController(db *gorm.DB) *ElementController {
-	return &ElementController{db: db}
+func NewElementController(db *gorm.DB, hub *ws.Hub) *ElementController {
+	return &ElementController{db: db, hub: hub, policy: policy.New(db)}
 }
 
 func (ec *ElementController) CreateElement(c *gin.Context) {
 	var input struct {
 		PageID          string             `json:"page_id" binding:"required"`
 		Type            models.ElementType `json:"type" binding:"required"`
-		Data            models.JSON        `json:"data" binding:"required"`
+		Data            models.JSON        `json:"data"`
 		PositionX       int                `json:"position_x" binding:"required"`
 		PositionY       int                `json:"position_y" binding:"required"`
 		Width           int                `json:"width" binding:"required"`
 		Height          int                `json:"height" binding:"required"`
 		ZIndex          int                `json:"z_index"`
 		ParentElementID *string            `json:"parent_element_id"`
+		Layouts         models.Layouts     `json:"layouts"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -36,25 +41,26 @@ func (ec *ElementController) CreateElement(c *gin.Context) {
 		return
 	}
 
-	element := models.Element{
-		ID:              uuid.New().String(),
+	change, err := ec.applyOperation(c.GetString("userID"), "", &ElementOperation{
+		Op:              OpCreate,
 		PageID:          input.PageID,
 		Type:            input.Type,
 		Data:            input.Data,
-		PositionX:       input.PositionX,
-		PositionY:       input.PositionY,
-		Width:           input.Width,
-		Height:          input.Height,
-		ZIndex:          input.ZIndex,
+		PositionX:       &input.PositionX,
+		PositionY:       &input.PositionY,
+		Width:           &input.Width,
+		Height:          &input.Height,
+		ZIndex:          &input.ZIndex,
 		ParentElementID: input.ParentElementID,
-	}
-
-	if err := ec.db.Create(&element).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create element"})
+		Layouts:         input.Layouts,
+		Node:            "rest:" + c.GetString("userID"),
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create element")
 		return
 	}
 
-	c.JSON(http.StatusCreated, element)
+	c.JSON(http.StatusCreated, change.Element)
 }
 
 func (ec *ElementController) GetElement(c *gin.Context) {
@@ -80,6 +86,10 @@ func (ec *ElementController) UpdateElement(c *gin.Context) {
 		Width     *int        `json:"width"`
 		Height    *int        `json:"height"`
 		ZIndex    *int        `json:"z_index"`
+		// Breakpoint targets a layout override; desktop when empty
+		Breakpoint  string `json:"breakpoint"`
+		Hidden      *bool  `json:"hidden"`
+		ResetLayout bool   `json:"reset_layout"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -87,46 +97,39 @@ func (ec *ElementController) UpdateElement(c *gin.Context) {
 		return
 	}
 
-	var element models.Element
-	if err := ec.db.First(&element, "id = ?", elementID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Element not found"})
-		return
-	}
-
 	// Update only provided fields
-	if input.Data != nil {
-		element.Data = input.Data
-	}
-	if input.PositionX != nil {
-		element.PositionX = *input.PositionX
-	}
-	if input.PositionY != nil {
-		element.PositionY = *input.PositionY
-	}
-	if input.Width != nil {
-		element.Width = *input.Width
-	}
-	if input.Height != nil {
-		element.Height = *input.Height
-	}
-	if input.ZIndex != nil {
-		element.ZIndex = *input.ZIndex
-	}
-
-	if err := ec.db.Save(&element).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update element"})
+	change, err := ec.applyOperation(c.GetString("userID"), "", &ElementOperation{
+		Op:          OpUpdate,
+		ElementID:   elementID,
+		Data:        input.Data,
+		PositionX:   input.PositionX,
+		PositionY:   input.PositionY,
+		Width:       input.Width,
+		Height:      input.Height,
+		ZIndex:      input.ZIndex,
+		Breakpoint:  input.Breakpoint,
+		Hidden:      input.Hidden,
+		ResetLayout: input.ResetLayout,
+		Node:        "rest:" + c.GetString("userID"),
+		ReplaceData: true,
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update element")
 		return
 	}
 
-	c.JSON(http.StatusOK, element)
+	c.JSON(http.StatusOK, change.Element)
 }
 
 // DeleteElement deletes an element
 func (ec *ElementController) DeleteElement(c *gin.Context) {
 	elementID := c.Param("id")
 
-	if err := ec.db.Delete(&models.Element{}, "id = ?", elementID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete element"})
+	if _, err := ec.applyOperation(c.GetString("userID"), "", &ElementOperation{
+		Op:        OpDelete,
+		ElementID: elementID,
+	}); err != nil {
+		respondError(c, err, "Failed to delete element")
 		return
 	}
 
@@ -149,3 +152,9 @@ func (ec *ElementController) ListElements(c *gin.Context) {
 
 	c.JSON(http.StatusOK, elements)
 }
+
+// ListElementTypes describes every element type and the data it accepts,
+// for building the palette and inspectors
+func (ec *ElementController) ListElementTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, elements.Palette())
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"website-builder/models"
+	"website-builder/policy"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxBatchOperations bounds the work done in one batch transaction.
+const maxBatchOperations = 500
+
+const elementBatchEvent = "element.batch"
+
+// BatchOperation is an ElementOperation that may be addressed by a
+// client-chosen temporary ID. A create with a temp_id records the real ID it
+// was given; later operations in the same batch may use the temp_id in
+// element_id or parent_element_id. Updates patch Data key by key, as over
+// the socket.
+type BatchOperation struct {
+	ElementOperation
+	TempID string `json:"temp_id"`
+}
+
+// ElementBatch is the result of a batch, broadcast to the project room as a
+// single change set. Each change takes its own page sequence; the page is
+// locked for the batch, so they run without gaps from FirstSeq to Seq.
+type ElementBatch struct {
+	ProjectID string            `json:"project_id"`
+	PageID    string            `json:"page_id"`
+	FirstSeq  uint64            `json:"first_seq"`
+	Seq       uint64            `json:"seq"`
+	Changes   []*ElementChange  `json:"changes"`
+	TempIDs   map[string]string `json:"temp_ids"`
+	UserID    string            `json:"user_id"`
+
+	node string
+	// components were created alongside the elements, and are announced
+	// before them so clients know them when instances arrive.
+	components []models.Component
+}
+
+// BatchElements applies an ordered list of element operations to a page
+// atomically
+func (ec *ElementController) BatchElements(c *gin.Context) {
+	var input struct {
+		Operations []BatchOperation `json:"operations" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("userID")
+	batch, err := ec.applyBatch(userID, "", c.Param("id"), "rest:"+userID, input.Operations)
+	if err != nil {
+		respondError(c, err, "Failed to apply operations")
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+func (ec *ElementController) socketBatch(client *ws.Client, env *ws.Envelope) (interface{}, error) {
+	if env.ProjectID == "" || env.PageID == "" {
+		return nil, ws.NewError(ws.ErrBadRequest, "project_id and page_id are required")
+	}
+	if err := authorizeSocket(ec.policy, client.UserID, policy.Edit,
+		policy.Resource{Kind: policy.Project, ID: env.ProjectID}); err != nil {
+		return nil, err
+	}
+
+	var input struct {
+		Operations []BatchOperation `json:"operations"`
+	}
+	if err := env.Decode(&input); err != nil {
+		return nil, err
+	}
+	return ec.applyBatch(client.UserID, env.ProjectID, env.PageID, client.ID, input.Operations)
+}
+
+// applyBatch runs every operation against pageID in one transaction. The
+// first failing operation rolls the whole batch back.
+func (ec *ElementController) applyBatch(userID string, projectID string, pageID string, node string, ops []BatchOperation) (*ElementBatch, error) {
+	if len(ops) == 0 {
+		return nil, ws.NewError(ws.ErrBadRequest, "operations must not be empty")
+	}
+	if len(ops) > maxBatchOperations {
+		return nil, ws.NewError(ws.ErrBadRequest, fmt.Sprintf("at most %d operations are allowed", maxBatchOperations))
+	}
+
+	return ec.changeSet(userID, projectID, pageID, node, func(tx *gorm.DB, batch *ElementBatch) error {
+		for i := range ops {
+			op := &ops[i].ElementOperation
+			if op.Op == "" {
+				return batchError(i, ws.NewError(ws.ErrBadRequest, "op is required"))
+			}
+			op.ReplaceData = false
+
+			tempID := ops[i].TempID
+			if op.Op == OpCreate && tempID != "" {
+				if _, taken := batch.TempIDs[tempID]; taken {
+					return batchError(i, ws.NewError(ws.ErrBadRequest, "temp_id "+tempID+" is used twice"))
+				}
+				op.ElementID = ""
+			} else if realID, ok := batch.TempIDs[op.ElementID]; ok {
+				op.ElementID = realID
+			}
+			if op.ParentElementID != nil {
+				if realID, ok := batch.TempIDs[*op.ParentElementID]; ok {
+					op.ParentElementID = &realID
+				}
+			}
+
+			change, err := batch.apply(tx, op)
+			if err != nil {
+				return batchError(i, err)
+			}
+			if op.Op == OpCreate && tempID != "" {
+				batch.TempIDs[tempID] = change.ElementID
+			}
+		}
+		return nil
+	})
+}
+
+// changeSet runs fn in one transaction with the page locked, then
+// broadcasts every change fn applied through batch.apply as a single
+// element.batch event.
+func (ec *ElementController) changeSet(userID string, projectID string, pageID string, node string, fn func(tx *gorm.DB, batch *ElementBatch) error) (*ElementBatch, error) {
+	return runChangeSet(ec.db, ec.hub, userID, projectID, pageID, node, fn)
+}
+
+func runChangeSet(db *gorm.DB, hub *ws.Hub, userID string, projectID string, pageID string, node string, fn func(tx *gorm.DB, batch *ElementBatch) error) (*ElementBatch, error) {
+	batch := newElementBatch(userID, pageID, node)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var page models.Page
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "project_id").First(&page, "id = ?", pageID).Error; err != nil {
+			return notFoundOr(err, "page not found")
+		}
+		if projectID != "" && page.ProjectID != projectID {
+			return ws.NewError(ws.ErrForbidden, "page does not belong to project")
+		}
+		batch.ProjectID = page.ProjectID
+		return fn(tx, batch)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	publishBatch(hub, batch)
+	return batch, nil
+}
+
+func newElementBatch(userID string, pageID string, node string) *ElementBatch {
+	return &ElementBatch{
+		PageID:  pageID,
+		TempIDs: map[string]string{},
+		UserID:  userID,
+		Changes: []*ElementChange{},
+		node:    node,
+	}
+}
+
+// publishBatch broadcasts a committed batch to its project room, unless
+// nothing changed.
+func publishBatch(hub *ws.Hub, batch *ElementBatch) {
+	for _, component := range batch.components {
+		hub.Publish(ws.ProjectRoom(batch.ProjectID), "component.created", component)
+	}
+	if len(batch.Changes) == 0 {
+		return
+	}
+	env, err := ws.NewEnvelope(elementBatchEvent, batch)
+	if err != nil {
+		return
+	}
+	env.ProjectID = batch.ProjectID
+	env.PageID = batch.PageID
+	hub.Post(&ws.Message{Room: ws.ProjectRoom(batch.ProjectID), Envelope: env})
+}
+
+// apply runs op against the batch's page and records the change.
+func (b *ElementBatch) apply(tx *gorm.DB, op *ElementOperation) (*ElementChange, error) {
+	op.PageID = b.PageID
+	op.Node = b.node
+	op.UserID = b.UserID
+
+	change, err := applyElementOperation(tx, b.ProjectID, op)
+	if err != nil {
+		return nil, err
+	}
+	if change.Seq > 0 {
+		change.UserID = b.UserID
+		if b.FirstSeq == 0 {
+			b.FirstSeq = change.Seq
+		}
+		b.Seq = change.Seq
+		b.Changes = append(b.Changes, change)
+	}
+	return change, nil
+}
+
+// batchError prefixes a protocol error with the index of the operation that
+// caused it.
+func batchError(index int, err error) error {
+	var protoErr *ws.Error
+	if !errors.As(err, &protoErr) {
+		return err
+	}
+	return &ws.Error{
+		Code:    protoErr.Code,
+		Message: fmt.Sprintf("operation %d: %s", index, protoErr.Message),
+		Details: gin.H{"index": index, "errors": protoErr.Details},
+	}
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"website-builder/elements"
+	"website-builder/layout"
+	"website-builder/models"
+	"website-builder/policy"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// duplicateOffset shifts a copy placed next to its original so the two do
+// not sit exactly on top of each other.
+const duplicateOffset = 20
+
+// ElementCopy is the result of duplicating an element subtree.
+type ElementCopy struct {
+	ElementID string `json:"element_id"`
+	// IDs maps every copied element to its copy.
+	IDs map[string]string `json:"ids"`
+	// Components lists the components copied into another project along
+	// with instances of them.
+	Components []models.Component `json:"components,omitempty"`
+	Batch      *ElementBatch      `json:"batch"`
+}
+
+// DuplicateElement deep-copies an element and everything nested under it.
+// The copy lands on the same page next to the original unless page_id or
+// project_id (whose homepage is used) names another target the caller can
+// edit. References to copied elements inside Data are pointed at the copies.
+// Components placed in the subtree are copied too when the target is in
+// another project.
+func (ec *ElementController) DuplicateElement(c *gin.Context) {
+	var input struct {
+		PageID          string  `json:"page_id"`
+		ProjectID       string  `json:"project_id"`
+		ParentElementID *string `json:"parent_element_id"`
+		OffsetX         *int    `json:"offset_x"`
+		OffsetY         *int    `json:"offset_y"`
+	}
+
+	// An empty body duplicates in place
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var source models.Element
+	if err := ec.db.Select("id", "page_id").First(&source, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Element not found"})
+		return
+	}
+
+	userID := c.GetString("userID")
+	pageID, err := ec.copyTarget(userID, source.PageID, input.PageID, input.ProjectID)
+	if err != nil {
+		respondError(c, err, "Failed to duplicate element")
+		return
+	}
+
+	result := &ElementCopy{IDs: map[string]string{}}
+	result.Batch, err = ec.changeSet(userID, "", pageID, "rest:"+userID, func(tx *gorm.DB, batch *ElementBatch) error {
+		subtree, err := loadSubtree(tx, source.PageID, source.ID)
+		if err != nil {
+			return err
+		}
+		if len(subtree) > maxBatchOperations {
+			return ws.NewError(ws.ErrBadRequest, fmt.Sprintf("at most %d elements can be duplicated at once", maxBatchOperations))
+		}
+
+		root := subtree[0]
+		samePage := pageID == root.PageID
+		parentID := input.ParentElementID
+		if parentID == nil && samePage {
+			parentID = root.ParentElementID
+		}
+
+		offsetX, offsetY := 0, 0
+		if samePage {
+			offsetX, offsetY = duplicateOffset, duplicateOffset
+		}
+		if input.OffsetX != nil {
+			offsetX = *input.OffsetX
+		}
+		if input.OffsetY != nil {
+			offsetY = *input.OffsetY
+		}
+
+		// Keep the copy where the original sits on its page, measured in
+		// the frame of the parent it is pasted into
+		x, y := root.PositionX, root.PositionY
+		if !sameParent(parentID, root.ParentElementID) || !samePage {
+			sourceFrames, err := loadFrames(tx, root.PageID)
+			if err != nil {
+				return err
+			}
+			targetFrames := sourceFrames
+			if !samePage {
+				if targetFrames, err = loadFrames(tx, pageID); err != nil {
+					return err
+				}
+			}
+			fromX, fromY := sourceFrames.origin(root.ParentElementID)
+			toX, toY := targetFrames.origin(parentID)
+			x, y = x+fromX-toX, y+fromY-toY
+		}
+		x, y = x+offsetX, y+offsetY
+
+		// The copy goes on top of its new siblings
+		siblings, err := loadSiblings(tx, pageID, parentID)
+		if err != nil {
+			return err
+		}
+		zIndex := 0
+		if len(siblings) > 0 {
+			zIndex = siblings[len(siblings)-1].ZIndex + 1
+		}
+
+		// Overrides for breakpoints the target project lacks are dropped
+		breakpoints, err := projectBreakpoints(tx, batch.ProjectID)
+		if err != nil {
+			return err
+		}
+		components, err := copyComponents(tx, subtree, batch.ProjectID)
+		if err != nil {
+			return err
+		}
+
+		pairs := make([]string, 0, 2*len(subtree))
+		for _, element := range subtree {
+			result.IDs[element.ID] = uuid.New().String()
+			pairs = append(pairs, element.ID, result.IDs[element.ID])
+		}
+		references := strings.NewReplacer(pairs...)
+
+		for i := range subtree {
+			element := subtree[i]
+			op := &ElementOperation{
+				Op:              OpCreate,
+				ElementID:       result.IDs[element.ID],
+				Type:            element.Type,
+				Data:            remapReferences(element.Data, references).(models.JSON),
+				PositionX:       &element.PositionX,
+				PositionY:       &element.PositionY,
+				Width:           &element.Width,
+				Height:          &element.Height,
+				ZIndex:          &element.ZIndex,
+				ParentElementID: element.ParentElementID,
+				Layouts:         copyLayouts(element.Layouts, breakpoints, 0, 0),
+			}
+			if element.Type == models.ComponentElement {
+				if component, ok := components[elements.DataString(element.Data, "component_id", "")]; ok {
+					op.Data["component_id"] = component.ID
+				}
+			}
+			if i == 0 {
+				op.PositionX, op.PositionY, op.ZIndex = &x, &y, &zIndex
+				op.ParentElementID = parentID
+				op.Layouts = copyLayouts(element.Layouts, breakpoints, x-element.PositionX, y-element.PositionY)
+			} else {
+				parent := result.IDs[*element.ParentElementID]
+				op.ParentElementID = &parent
+			}
+			if _, err := batch.apply(tx, op); err != nil {
+				return err
+			}
+		}
+		result.ElementID = result.IDs[root.ID]
+		for _, component := range components {
+			result.Components = append(result.Components, *component)
+		}
+		batch.components = result.Components
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to duplicate element")
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// copyTarget resolves the page a copy is pasted into and checks the caller
+// may edit it. The route only requires read access to the source.
+func (ec *ElementController) copyTarget(userID string, sourcePageID string, pageID string, projectID string) (string, error) {
+	if pageID == "" && projectID == "" {
+		pageID = sourcePageID
+	}
+
+	if pageID == "" {
+		if err := authorizeSocket(ec.policy, userID, policy.Edit,
+			policy.Resource{Kind: policy.Project, ID: projectID}); err != nil {
+			return "", err
+		}
+		var page models.Page
+		if err := ec.db.Where("project_id = ?", projectID).
+			Order("is_homepage DESC").Order("position").
+			First(&page).Error; err != nil {
+			return "", notFoundOr(err, "project has no pages")
+		}
+		return page.ID, nil
+	}
+
+	if err := authorizeSocket(ec.policy, userID, policy.Edit,
+		policy.Resource{Kind: policy.Page, ID: pageID}); err != nil {
+		return "", err
+	}
+	if projectID != "" {
+		var page models.Page
+		if err := ec.db.Select("id", "project_id").First(&page, "id = ?", pageID).Error; err != nil {
+			return "", notFoundOr(err, "page not found")
+		}
+		if page.ProjectID != projectID {
+			return "", ws.NewError(ws.ErrBadRequest, "page does not belong to project")
+		}
+	}
+	return pageID, nil
+}
+
+// copyComponents copies the components placed in subtree that belong to
+// another project into projectID, keeping their node IDs so instance
+// overrides still apply. It returns the copies by original ID.
+func copyComponents(tx *gorm.DB, subtree []models.Element, projectID string) (map[string]*models.Component, error) {
+	copies := map[string]*models.Component{}
+	for _, element := range subtree {
+		if element.Type != models.ComponentElement {
+			continue
+		}
+		id := elements.DataString(element.Data, "component_id", "")
+		if _, done := copies[id]; done {
+			continue
+		}
+		var component models.Component
+		if err := tx.First(&component, "id = ?", id).Error; err != nil {
+			return nil, notFoundOr(err, "component not found")
+		}
+		if component.ProjectID == projectID {
+			continue
+		}
+		copied := &models.Component{
+			ID:        uuid.New().String(),
+			ProjectID: projectID,
+			Name:      component.Name,
+			Width:     component.Width,
+			Height:    component.Height,
+			Elements:  component.Elements,
+			Version:   1,
+		}
+		if err := tx.Create(copied).Error; err != nil {
+			return nil, err
+		}
+		copies[id] = copied
+	}
+	return copies, nil
+}
+
+// copyLayouts copies the overrides for breakpoints in breakpoints,
+// moving their positions by dx, dy.
+func copyLayouts(layouts models.Layouts, breakpoints models.Breakpoints, dx int, dy int) models.Layouts {
+	copied := make(models.Layouts, len(layouts))
+	for name, override := range layouts {
+		if !layout.Has(breakpoints, name) {
+			continue
+		}
+		if override.PositionX != nil {
+			x := *override.PositionX + dx
+			override.PositionX = &x
+		}
+		if override.PositionY != nil {
+			y := *override.PositionY + dy
+			override.PositionY = &y
+		}
+		copied[name] = override
+	}
+	return copied
+}
+
+// loadSubtree returns rootID followed by its descendants, parents always
+// before their children.
+func loadSubtree(tx *gorm.DB, pageID string, rootID string) ([]models.Element, error) {
+	ids, err := descendantIDs(tx, pageID, rootID)
+	if err != nil {
+		return nil, err
+	}
+	ids = append([]string{rootID}, ids...)
+
+	var elements []models.Element
+	if err := tx.Where("id IN ?", ids).Find(&elements).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Element, len(elements))
+	for _, element := range elements {
+		byID[element.ID] = element
+	}
+
+	subtree := make([]models.Element, 0, len(ids))
+	for _, id := range ids {
+		element, ok := byID[id]
+		if !ok {
+			return nil, ws.NewError(ws.ErrNotFound, "element not found")
+		}
+		subtree = append(subtree, element)
+	}
+	return subtree, nil
+}
+
+// remapReferences deep-copies a Data value, rewriting every mention of a
+// copied element's ID in its strings, such as anchor links, to the copy.
+func remapReferences(value interface{}, references *strings.Replacer) interface{} {
+	switch v := value.(type) {
+	case models.JSON:
+		return models.JSON(remapReferences(map[string]interface{}(v), references).(map[string]interface{}))
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = remapReferences(item, references)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = remapReferences(item, references)
+		}
+		return copied
+	case string:
+		return references.Replace(v)
+	default:
+		return v
+	}
+}
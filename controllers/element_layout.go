@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"website-builder/crdt"
+	"website-builder/layout"
+	"website-builder/models"
+	ws "website-builder/websocket"
+
+	"gorm.io/gorm"
+)
+
+// projectBreakpoints returns every breakpoint of a project, widest first.
+func projectBreakpoints(tx *gorm.DB, projectID string) (models.Breakpoints, error) {
+	var project models.Project
+	if err := tx.Select("id", "breakpoints").First(&project, "id = ?", projectID).Error; err != nil {
+		return nil, notFoundOr(err, "project not found")
+	}
+	return layout.Resolve(project.Breakpoints), nil
+}
+
+// checkBreakpoints makes sure op only addresses breakpoints the project
+// has, and only where a breakpoint makes sense.
+func checkBreakpoints(tx *gorm.DB, projectID string, op *ElementOperation) error {
+	if op.Breakpoint == "" && len(op.Layouts) == 0 {
+		return nil
+	}
+	switch {
+	case op.Op == OpCreate && op.Breakpoint != "":
+		return ws.NewError(ws.ErrBadRequest, "elements are created at desktop; pass layouts for other breakpoints")
+	case op.Op != OpCreate && len(op.Layouts) > 0:
+		return ws.NewError(ws.ErrBadRequest, "layouts can only be set on create; update one breakpoint at a time")
+	case op.Op == OpReparent:
+		return ws.NewError(ws.ErrBadRequest, "an element has the same parent at every breakpoint")
+	}
+
+	breakpoints, err := projectBreakpoints(tx, projectID)
+	if err != nil {
+		return err
+	}
+	if op.Breakpoint != "" && !layout.Has(breakpoints, op.Breakpoint) {
+		return ws.NewError(ws.ErrBadRequest, "unknown breakpoint "+op.Breakpoint)
+	}
+	for name := range op.Layouts {
+		if !layout.Has(breakpoints, name) {
+			return ws.NewError(ws.ErrBadRequest, "unknown breakpoint "+name)
+		}
+	}
+	return nil
+}
+
+// mergeOverride applies patch to the element's override for one
+// breakpoint, each field under its own register. With reset set, fields
+// the patch leaves out are cleared so they inherit again.
+func mergeOverride(result *crdt.Result, element *models.Element, name string, patch models.LayoutOverride, reset bool, ts crdt.Timestamp) {
+	if element.Layouts == nil {
+		element.Layouts = models.Layouts{}
+	}
+	override := element.Layouts[name]
+	prefix := "layouts." + name + "."
+
+	fields := []struct {
+		name   string
+		target **int
+		value  *int
+	}{
+		{"position_x", &override.PositionX, patch.PositionX},
+		{"position_y", &override.PositionY, patch.PositionY},
+		{"width", &override.Width, patch.Width},
+		{"height", &override.Height, patch.Height},
+		{"z_index", &override.ZIndex, patch.ZIndex},
+	}
+	for _, field := range fields {
+		if reset && field.value == nil {
+			if result.Clear(element.Clocks, prefix+field.name, ts) {
+				*field.target = nil
+			}
+			continue
+		}
+		result.SetOptionalInt(element.Clocks, prefix+field.name, field.target, field.value, ts)
+	}
+	if reset && patch.Hidden == nil {
+		if result.Clear(element.Clocks, prefix+"hidden", ts) {
+			override.Hidden = nil
+		}
+	} else {
+		result.SetOptionalBool(element.Clocks, prefix+"hidden", &override.Hidden, patch.Hidden, ts)
+	}
+
+	if override.Empty() {
+		delete(element.Layouts, name)
+	} else {
+		element.Layouts[name] = override
+	}
+}
+
+// shiftOverrides moves every breakpoint's position override by dx, dy, so
+// they follow the element into a new parent's frame.
+func shiftOverrides(result *crdt.Result, element *models.Element, dx int, dy int, ts crdt.Timestamp) {
+	if dx == 0 && dy == 0 {
+		return
+	}
+	for name, override := range element.Layouts {
+		var patch models.LayoutOverride
+		if override.PositionX != nil {
+			x := *override.PositionX + dx
+			patch.PositionX = &x
+		}
+		if override.PositionY != nil {
+			y := *override.PositionY + dy
+			patch.PositionY = &y
+		}
+		if patch.PositionX != nil || patch.PositionY != nil {
+			mergeOverride(result, element, name, patch, false, ts)
+		}
+	}
+}
@@ -0,0 +1,492 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"website-builder/crdt"
+	"website-builder/elements"
+	"website-builder/layout"
+	"website-builder/models"
+	"website-builder/policy"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OpCreate   = "create"
+	OpUpdate   = "update"
+	OpMove     = "move"
+	OpReparent = "reparent"
+	OpDelete   = "delete"
+)
+
+// ElementOperation is a single change to a page's elements, sent either over
+// the socket or produced by the REST handlers.
+type ElementOperation struct {
+	Op              string             `json:"op"`
+	ElementID       string             `json:"element_id"`
+	PageID          string             `json:"page_id"`
+	Type            models.ElementType `json:"type"`
+	Data            models.JSON        `json:"data"`
+	PositionX       *int               `json:"position_x"`
+	PositionY       *int               `json:"position_y"`
+	Width           *int               `json:"width"`
+	Height          *int               `json:"height"`
+	ZIndex          *int               `json:"z_index"`
+	ParentElementID *string            `json:"parent_element_id"`
+	// Breakpoint sends the geometry of an update or move to that
+	// breakpoint's layout override instead of the desktop layout.
+	Breakpoint string `json:"breakpoint"`
+	// Hidden shows or hides the element from Breakpoint down.
+	Hidden *bool `json:"hidden"`
+	// ResetLayout clears the parts of Breakpoint's override the operation
+	// does not set, so they inherit again.
+	ResetLayout bool `json:"reset_layout"`
+	// Layouts seeds the overrides of a new element.
+	Layouts models.Layouts `json:"layouts"`
+
+	// Clock is the writer's Lamport clock. Operations without one are
+	// stamped after every write the server has seen for the element.
+	Clock uint64 `json:"clock"`
+	// Node identifies the writer for tie-breaking; set by the server.
+	Node string `json:"-"`
+	// UserID is the author, checked against element locks.
+	UserID string `json:"-"`
+	// ReplaceData drops Data keys missing from the operation instead of
+	// patching key by key.
+	ReplaceData bool `json:"-"`
+}
+
+// ElementChange is the canonical result of an operation that is fanned out
+// to everyone in the project room.
+type ElementChange struct {
+	Op        string          `json:"op"`
+	Seq       uint64          `json:"seq"`
+	ProjectID string          `json:"project_id"`
+	PageID    string          `json:"page_id"`
+	ElementID string          `json:"element_id"`
+	Element   *models.Element `json:"element,omitempty"`
+	Removed   []string        `json:"removed,omitempty"`
+	Rejected  []string        `json:"rejected,omitempty"`
+	UserID    string          `json:"user_id"`
+}
+
+const elementChangedEvent = "element.changed"
+
+// RegisterSocketHandlers exposes element operations on the WebSocket.
+func (ec *ElementController) RegisterSocketHandlers() {
+	ec.hub.Handle("element.create", ec.socketOperation(OpCreate))
+	ec.hub.Handle("element.update", ec.socketOperation(OpUpdate))
+	ec.hub.Handle("element.move", ec.socketOperation(OpMove))
+	ec.hub.Handle("element.reparent", ec.socketOperation(OpReparent))
+	ec.hub.Handle("element.delete", ec.socketOperation(OpDelete))
+	ec.hub.Handle("element.batch", ec.socketBatch)
+}
+
+func (ec *ElementController) socketOperation(op string) ws.HandlerFunc {
+	return func(client *ws.Client, env *ws.Envelope) (interface{}, error) {
+		if env.ProjectID == "" || env.PageID == "" {
+			return nil, ws.NewError(ws.ErrBadRequest, "project_id and page_id are required")
+		}
+		if err := authorizeSocket(ec.policy, client.UserID, policy.Edit,
+			policy.Resource{Kind: policy.Project, ID: env.ProjectID}); err != nil {
+			return nil, err
+		}
+
+		var input ElementOperation
+		if err := env.Decode(&input); err != nil {
+			return nil, err
+		}
+		input.Op = op
+		input.PageID = env.PageID
+		input.Node = client.ID
+
+		return ec.applyOperation(client.UserID, env.ProjectID, &input)
+	}
+}
+
+// applyOperation runs op in its own transaction and broadcasts the result.
+// When projectID is set the page must belong to that project.
+func (ec *ElementController) applyOperation(userID string, projectID string, op *ElementOperation) (*ElementChange, error) {
+	op.UserID = userID
+
+	var change *ElementChange
+	err := ec.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		change, err = applyElementOperation(tx, projectID, op)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	change.UserID = userID
+	if change.Seq > 0 {
+		ec.publishChange(change)
+	}
+	return change, nil
+}
+
+func (ec *ElementController) publishChange(change *ElementChange) {
+	env, err := ws.NewEnvelope(elementChangedEvent, change)
+	if err != nil {
+		return
+	}
+	env.ProjectID = change.ProjectID
+	env.PageID = change.PageID
+	ec.hub.Post(&ws.Message{Room: ws.ProjectRoom(change.ProjectID), Envelope: env})
+}
+
+// applyElementOperation applies op inside tx, bumping the page's element
+// sequence so every change to a page is totally ordered. Field writes are
+// merged through per-field Lamport registers; an operation whose every
+// field loses leaves the page untouched and returns a zero Seq.
+func applyElementOperation(tx *gorm.DB, projectID string, op *ElementOperation) (*ElementChange, error) {
+	var element models.Element
+	if op.Op != OpCreate {
+		if op.ElementID == "" {
+			return nil, ws.NewError(ws.ErrBadRequest, "element_id is required")
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&element, "id = ?", op.ElementID).Error; err != nil {
+			return nil, notFoundOr(err, "element not found")
+		}
+		if op.PageID != "" && op.PageID != element.PageID {
+			return nil, ws.NewError(ws.ErrBadRequest, "element does not belong to page")
+		}
+		op.PageID = element.PageID
+		if op.Op != OpDelete {
+			if err := checkLocks(tx, []string{element.ID}, op.UserID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if op.PageID == "" {
+		return nil, ws.NewError(ws.ErrBadRequest, "page_id is required")
+	}
+
+	var page models.Page
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&page, "id = ?", op.PageID).Error; err != nil {
+		return nil, notFoundOr(err, "page not found")
+	}
+	if projectID != "" && page.ProjectID != projectID {
+		return nil, ws.NewError(ws.ErrForbidden, "page does not belong to project")
+	}
+	if err := checkBreakpoints(tx, page.ProjectID, op); err != nil {
+		return nil, err
+	}
+
+	change := &ElementChange{
+		Op:        op.Op,
+		ProjectID: page.ProjectID,
+		PageID:    page.ID,
+		ElementID: op.ElementID,
+	}
+
+	if element.Clocks == nil {
+		element.Clocks = crdt.Clocks{}
+	}
+	ts := crdt.Timestamp{Clock: op.Clock, Node: op.Node}
+	if ts.Clock == 0 {
+		ts.Clock = element.Clocks.Max() + 1
+	} else if !element.Clocks.Admits(ts.Clock) {
+		return nil, ws.NewError(ws.ErrBadRequest, "clock is too far ahead of the element's")
+	}
+
+	var result crdt.Result
+	switch op.Op {
+	case OpCreate:
+		if op.Type == "" {
+			return nil, ws.NewError(ws.ErrBadRequest, "type is required")
+		}
+		elementType, ok := elements.Lookup(string(op.Type))
+		if !ok {
+			return nil, ws.NewError(ws.ErrBadRequest, "unknown element type "+string(op.Type))
+		}
+		// Keys the client leaves out start from the type's defaults
+		data := elementType.DefaultData()
+		for key, value := range op.Data {
+			data[key] = value
+		}
+		op.Data = data
+		if err := checkParent(tx, page.ID, op.ParentElementID); err != nil {
+			return nil, err
+		}
+		element = models.Element{
+			ID:              op.ElementID,
+			PageID:          page.ID,
+			Type:            op.Type,
+			Data:            models.JSON{},
+			ParentElementID: op.ParentElementID,
+			Clocks:          crdt.Clocks{},
+		}
+		if element.ID == "" {
+			element.ID = uuid.New().String()
+		} else if err := checkNewID(tx, element.ID); err != nil {
+			return nil, err
+		}
+		result.MergeData(element.Clocks, element.Data, op.Data, ts)
+		mergeGeometry(&result, &element, op, ts)
+		for name, override := range op.Layouts {
+			mergeOverride(&result, &element, name, override, false, ts)
+		}
+		if err := checkElementData(tx, page.ProjectID, &element); err != nil {
+			return nil, err
+		}
+		if err := tx.Create(&element).Error; err != nil {
+			return nil, err
+		}
+		change.ElementID = element.ID
+		change.Element = &element
+	case OpUpdate, OpMove:
+		if op.Op == OpMove && (op.PositionX == nil || op.PositionY == nil) {
+			return nil, ws.NewError(ws.ErrBadRequest, "position_x and position_y are required")
+		}
+		if op.Op == OpUpdate && op.Data != nil {
+			if element.Data == nil {
+				element.Data = models.JSON{}
+			}
+			patch := map[string]interface{}(op.Data)
+			if op.ReplaceData {
+				patch = replacementPatch(element.Data, op.Data)
+			}
+			result.MergeData(element.Clocks, element.Data, patch, ts)
+		}
+		mergeGeometry(&result, &element, op, ts)
+		change.Element = &element
+		change.Rejected = result.Rejected
+		if !result.Changed() {
+			return change, nil
+		}
+		if op.Data != nil {
+			if err := checkElementData(tx, page.ProjectID, &element); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Save(&element).Error; err != nil {
+			return nil, err
+		}
+	case OpReparent:
+		if err := checkReparent(tx, page.ID, element.ID, op.ParentElementID); err != nil {
+			return nil, err
+		}
+		// Without explicit coordinates the element keeps its place on the
+		// page, converted into the new parent's frame
+		if op.PositionX == nil || op.PositionY == nil {
+			frames, err := loadFrames(tx, page.ID)
+			if err != nil {
+				return nil, err
+			}
+			x, y := frames.convert(element.PositionX, element.PositionY, element.ParentElementID, op.ParentElementID)
+			op.PositionX, op.PositionY = &x, &y
+		}
+		result.SetRef(element.Clocks, "parent_element_id", &element.ParentElementID, op.ParentElementID, ts)
+		if result.Changed() {
+			// Coordinates only make sense in the frame of the parent that won
+			x, y := element.PositionX, element.PositionY
+			mergeGeometry(&result, &element, op, ts)
+			shiftOverrides(&result, &element, element.PositionX-x, element.PositionY-y, ts)
+		}
+		change.Element = &element
+		change.Rejected = result.Rejected
+		if !result.Changed() {
+			return change, nil
+		}
+		if err := tx.Save(&element).Error; err != nil {
+			return nil, err
+		}
+	case OpDelete:
+		ids, err := descendantIDs(tx, page.ID, element.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, element.ID)
+		if err := checkLocks(tx, ids, op.UserID); err != nil {
+			return nil, err
+		}
+		if err := deleteElements(tx, ids); err != nil {
+			return nil, err
+		}
+		change.Removed = ids
+	default:
+		return nil, ws.NewError(ws.ErrBadRequest, "unknown operation "+op.Op)
+	}
+
+	page.ElementSeq++
+	if err := tx.Model(&page).Update("element_seq", page.ElementSeq).Error; err != nil {
+		return nil, err
+	}
+	change.Seq = page.ElementSeq
+
+	return change, nil
+}
+
+func mergeGeometry(result *crdt.Result, element *models.Element, op *ElementOperation, ts crdt.Timestamp) {
+	if op.Breakpoint != "" && op.Breakpoint != layout.Desktop {
+		patch := models.LayoutOverride{PositionX: op.PositionX, PositionY: op.PositionY, ZIndex: op.ZIndex, Hidden: op.Hidden}
+		if op.Op != OpMove {
+			patch.Width, patch.Height = op.Width, op.Height
+		}
+		mergeOverride(result, element, op.Breakpoint, patch, op.ResetLayout, ts)
+		return
+	}
+
+	// Desktop geometry is the element's own; only visibility is an override
+	if op.Hidden != nil || op.ResetLayout {
+		mergeOverride(result, element, layout.Desktop, models.LayoutOverride{Hidden: op.Hidden}, op.ResetLayout, ts)
+	}
+	result.SetInt(element.Clocks, "position_x", &element.PositionX, op.PositionX, ts)
+	result.SetInt(element.Clocks, "position_y", &element.PositionY, op.PositionY, ts)
+	result.SetInt(element.Clocks, "z_index", &element.ZIndex, op.ZIndex, ts)
+	if op.Op == OpMove || op.Op == OpReparent {
+		return
+	}
+	result.SetInt(element.Clocks, "width", &element.Width, op.Width, ts)
+	result.SetInt(element.Clocks, "height", &element.Height, op.Height, ts)
+}
+
+// replacementPatch turns a full Data document into a per-key patch that
+// also removes keys the new document no longer has.
+func replacementPatch(current models.JSON, data models.JSON) map[string]interface{} {
+	patch := make(map[string]interface{}, len(data))
+	for key := range current {
+		patch[key] = nil
+	}
+	for key, value := range data {
+		patch[key] = value
+	}
+	return patch
+}
+
+// checkParent makes sure a parent element, if given, lives on the same page.
+func checkParent(tx *gorm.DB, pageID string, parentID *string) error {
+	if parentID == nil {
+		return nil
+	}
+	var parent models.Element
+	if err := tx.Select("id", "page_id").First(&parent, "id = ?", *parentID).Error; err != nil {
+		return notFoundOr(err, "parent element not found")
+	}
+	if parent.PageID != pageID {
+		return ws.NewError(ws.ErrBadRequest, "parent element is on another page")
+	}
+	return nil
+}
+
+// checkNewID checks an element ID chosen by the client. It must be a UUID
+// no other element has, including soft-deleted ones whose rows remain.
+func checkNewID(tx *gorm.DB, id string) error {
+	if !isUUID(id) {
+		return ws.NewError(ws.ErrBadRequest, "element_id must be a UUID")
+	}
+	var count int64
+	if err := tx.Unscoped().Model(&models.Element{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ws.NewError(ws.ErrConflict, "element "+id+" already exists")
+	}
+	return nil
+}
+
+// isUUID reports whether id is a UUID in the 36 character form stored in
+// ID columns. uuid.Parse alone also takes braced and URN forms.
+func isUUID(id string) bool {
+	parsed, err := uuid.Parse(id)
+	return err == nil && strings.EqualFold(parsed.String(), id)
+}
+
+// descendantIDs returns the IDs of every element nested under rootID.
+func descendantIDs(tx *gorm.DB, pageID string, rootID string) ([]string, error) {
+	var elements []models.Element
+	if err := tx.Select("id", "parent_element_id").
+		Where("page_id = ?", pageID).Find(&elements).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]string)
+	for _, el := range elements {
+		if el.ParentElementID != nil {
+			children[*el.ParentElementID] = append(children[*el.ParentElementID], el.ID)
+		}
+	}
+
+	var ids []string
+	queue := []string{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range children[id] {
+			ids = append(ids, child)
+			queue = append(queue, child)
+		}
+	}
+	return ids, nil
+}
+
+func notFoundOr(err error, message string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ws.NewError(ws.ErrNotFound, message)
+	}
+	return err
+}
+
+// respondError writes err as a JSON error, mapping protocol error codes to
+// HTTP statuses and hiding anything unexpected behind fallback.
+func respondError(c *gin.Context, err error, fallback string) {
+	var protoErr *ws.Error
+	if !errors.As(err, &protoErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+		return
+	}
+
+	status := http.StatusBadRequest
+	switch protoErr.Code {
+	case ws.ErrNotFound:
+		status = http.StatusNotFound
+	case ws.ErrForbidden:
+		status = http.StatusForbidden
+	case ws.ErrConflict:
+		status = http.StatusConflict
+	case ws.ErrValidation:
+		status = http.StatusUnprocessableEntity
+	case ws.ErrInternal:
+		status = http.StatusInternalServerError
+	}
+	if protoErr.Details != nil {
+		c.JSON(status, gin.H{"error": protoErr.Message, "details": protoErr.Details})
+		return
+	}
+	c.JSON(status, gin.H{"error": protoErr.Message})
+}
+
+// checkElementData validates an element's data, and for component
+// instances the component it places.
+func checkElementData(tx *gorm.DB, projectID string, element *models.Element) error {
+	if err := validateElementData(element); err != nil {
+		return err
+	}
+	if element.Type == models.ComponentElement {
+		return checkInstance(tx, projectID, element)
+	}
+	return nil
+}
+
+// validateElementData checks an element's data against the schema of its
+// type, reporting failures field by field.
+func validateElementData(element *models.Element) error {
+	err := elements.Validate(string(element.Type), element.Data)
+	var invalid *elements.ValidationError
+	if errors.As(err, &invalid) {
+		return &ws.Error{Code: ws.ErrValidation, Message: "invalid element data", Details: invalid.Errors}
+	}
+	return err
+}
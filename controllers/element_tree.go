@@ -0,0 +1,317 @@
+package controllers
+
+import (
+	"net/http"
+
+	"website-builder/models"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Element positions are relative to the parent element, or to the page for
+// root elements. frames resolves where each element's frame sits on the
+// page so coordinates can be moved between parents.
+type frame struct {
+	parent *string
+	x, y   int
+}
+
+type frames map[string]frame
+
+func loadFrames(tx *gorm.DB, pageID string) (frames, error) {
+	var elements []models.Element
+	if err := tx.Select("id", "parent_element_id", "position_x", "position_y").
+		Where("page_id = ?", pageID).Find(&elements).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(frames, len(elements))
+	for _, element := range elements {
+		result[element.ID] = frame{parent: element.ParentElementID, x: element.PositionX, y: element.PositionY}
+	}
+	return result, nil
+}
+
+// origin returns the page coordinates of the top-left corner of parentID,
+// which is where its children's coordinates are measured from.
+func (f frames) origin(parentID *string) (int, int) {
+	var x, y int
+	seen := make(map[string]bool)
+	for parentID != nil && !seen[*parentID] {
+		seen[*parentID] = true
+		current, ok := f[*parentID]
+		if !ok {
+			break
+		}
+		x += current.x
+		y += current.y
+		parentID = current.parent
+	}
+	return x, y
+}
+
+// convert translates a position in the frame of from into the frame of to.
+func (f frames) convert(x, y int, from *string, to *string) (int, int) {
+	fromX, fromY := f.origin(from)
+	toX, toY := f.origin(to)
+	return x + fromX - toX, y + fromY - toY
+}
+
+// checkReparent rejects parents on another page and moves that would nest
+// an element inside itself.
+func checkReparent(tx *gorm.DB, pageID string, elementID string, parentID *string) error {
+	if parentID == nil {
+		return nil
+	}
+	if *parentID == elementID {
+		return ws.NewError(ws.ErrBadRequest, "an element cannot be its own parent")
+	}
+	if err := checkParent(tx, pageID, parentID); err != nil {
+		return err
+	}
+
+	descendants, err := descendantIDs(tx, pageID, elementID)
+	if err != nil {
+		return err
+	}
+	for _, id := range descendants {
+		if id == *parentID {
+			return ws.NewError(ws.ErrBadRequest, "an element cannot be moved into its own descendant")
+		}
+	}
+	return nil
+}
+
+// ReparentElement moves an element under another parent, or to the page
+// root when parent_element_id is null. Unless a position is given the
+// element keeps its place on the page.
+func (ec *ElementController) ReparentElement(c *gin.Context) {
+	var input struct {
+		ParentElementID *string `json:"parent_element_id"`
+		PositionX       *int    `json:"position_x"`
+		PositionY       *int    `json:"position_y"`
+		ZIndex          *int    `json:"z_index"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, err := ec.applyOperation(c.GetString("userID"), "", &ElementOperation{
+		Op:              OpReparent,
+		ElementID:       c.Param("id"),
+		ParentElementID: input.ParentElementID,
+		PositionX:       input.PositionX,
+		PositionY:       input.PositionY,
+		ZIndex:          input.ZIndex,
+		Node:            "rest:" + c.GetString("userID"),
+	})
+	if err != nil {
+		respondError(c, err, "Failed to move element")
+		return
+	}
+
+	c.JSON(http.StatusOK, change.Element)
+}
+
+// ReorderElements sets the stacking order of the children of one parent,
+// or of the page's root elements. Every sibling must be listed once, back
+// to front.
+func (ec *ElementController) ReorderElements(c *gin.Context) {
+	var input struct {
+		ParentElementID *string  `json:"parent_element_id"`
+		ElementIDs      []string `json:"element_ids" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("userID")
+	batch, err := ec.changeSet(userID, "", c.Param("id"), "rest:"+userID, func(tx *gorm.DB, batch *ElementBatch) error {
+		siblings, err := loadSiblings(tx, batch.PageID, input.ParentElementID)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(siblings))
+		current := make(map[string]int, len(siblings))
+		for _, sibling := range siblings {
+			ids = append(ids, sibling.ID)
+			current[sibling.ID] = sibling.ZIndex
+		}
+		if !sameIDs(ids, input.ElementIDs) {
+			return ws.NewError(ws.ErrBadRequest, "element_ids must list every sibling exactly once")
+		}
+
+		for z, id := range input.ElementIDs {
+			if current[id] == z {
+				continue
+			}
+			zIndex := z
+			if _, err := batch.apply(tx, &ElementOperation{Op: OpUpdate, ElementID: id, ZIndex: &zIndex}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to reorder elements")
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+// GroupElements wraps sibling elements in a new section sized to fit them.
+// The section takes the place of the topmost element of the selection.
+func (ec *ElementController) GroupElements(c *gin.Context) {
+	var input struct {
+		ElementIDs []string    `json:"element_ids" binding:"required,min=1"`
+		Data       models.JSON `json:"data"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("userID")
+	batch, err := ec.changeSet(userID, "", c.Param("id"), "rest:"+userID, func(tx *gorm.DB, batch *ElementBatch) error {
+		var selection []models.Element
+		if err := tx.Where("id IN ? AND page_id = ?", input.ElementIDs, batch.PageID).
+			Order("z_index").Find(&selection).Error; err != nil {
+			return err
+		}
+		if len(selection) != len(input.ElementIDs) {
+			return ws.NewError(ws.ErrBadRequest, "every element must exist on this page and be listed once")
+		}
+
+		parentID := selection[0].ParentElementID
+		minX, minY := selection[0].PositionX, selection[0].PositionY
+		maxX, maxY := minX+selection[0].Width, minY+selection[0].Height
+		zIndex := selection[0].ZIndex
+		for _, element := range selection[1:] {
+			if !sameParent(element.ParentElementID, parentID) {
+				return ws.NewError(ws.ErrBadRequest, "grouped elements must share a parent")
+			}
+			minX = min(minX, element.PositionX)
+			minY = min(minY, element.PositionY)
+			maxX = max(maxX, element.PositionX+element.Width)
+			maxY = max(maxY, element.PositionY+element.Height)
+			zIndex = max(zIndex, element.ZIndex)
+		}
+
+		width, height := maxX-minX, maxY-minY
+		section, err := batch.apply(tx, &ElementOperation{
+			Op:              OpCreate,
+			Type:            models.SectionElement,
+			Data:            input.Data,
+			PositionX:       &minX,
+			PositionY:       &minY,
+			Width:           &width,
+			Height:          &height,
+			ZIndex:          &zIndex,
+			ParentElementID: parentID,
+		})
+		if err != nil {
+			return err
+		}
+
+		for z, element := range selection {
+			x, y, childZ := element.PositionX-minX, element.PositionY-minY, z
+			if _, err := batch.apply(tx, &ElementOperation{
+				Op:              OpReparent,
+				ElementID:       element.ID,
+				ParentElementID: &section.ElementID,
+				PositionX:       &x,
+				PositionY:       &y,
+				ZIndex:          &childZ,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to group elements")
+		return
+	}
+
+	c.JSON(http.StatusCreated, batch)
+}
+
+// UngroupElement lifts a section's children into the section's parent,
+// keeping their place on the page, and removes the section.
+func (ec *ElementController) UngroupElement(c *gin.Context) {
+	var section models.Element
+	if err := ec.db.First(&section, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Element not found"})
+		return
+	}
+
+	userID := c.GetString("userID")
+	batch, err := ec.changeSet(userID, "", section.PageID, "rest:"+userID, func(tx *gorm.DB, batch *ElementBatch) error {
+		if err := tx.First(&section, "id = ?", section.ID).Error; err != nil {
+			return notFoundOr(err, "element not found")
+		}
+		if section.Type != models.SectionElement {
+			return ws.NewError(ws.ErrBadRequest, "only sections can be ungrouped")
+		}
+
+		children, err := loadSiblings(tx, batch.PageID, &section.ID)
+		if err != nil {
+			return err
+		}
+		for i, child := range children {
+			x, y, z := child.PositionX+section.PositionX, child.PositionY+section.PositionY, section.ZIndex+i
+			if _, err := batch.apply(tx, &ElementOperation{
+				Op:              OpReparent,
+				ElementID:       child.ID,
+				ParentElementID: section.ParentElementID,
+				PositionX:       &x,
+				PositionY:       &y,
+				ZIndex:          &z,
+			}); err != nil {
+				return err
+			}
+		}
+
+		_, err = batch.apply(tx, &ElementOperation{Op: OpDelete, ElementID: section.ID})
+		return err
+	})
+	if err != nil {
+		respondError(c, err, "Failed to ungroup element")
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+// loadSiblings returns the children of parentID, or the page's root
+// elements when it is nil, back to front.
+func loadSiblings(tx *gorm.DB, pageID string, parentID *string) ([]models.Element, error) {
+	query := tx.Where("page_id = ?", pageID)
+	if parentID == nil {
+		query = query.Where("parent_element_id IS NULL")
+	} else {
+		query = query.Where("parent_element_id = ?", *parentID)
+	}
+
+	var siblings []models.Element
+	if err := query.Order("z_index").Order("created_at").Find(&siblings).Error; err != nil {
+		return nil, err
+	}
+	return siblings, nil
+}
+
+func sameParent(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
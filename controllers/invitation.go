@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"website-builder/mailer"
+	"website-builder/models"
+	"website-builder/utils"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InvitationTTL is how long an emailed invitation can be accepted.
+const InvitationTTL = 7 * 24 * time.Hour
+
+var (
+	errInvitationInvalid  = errors.New("invitation is invalid or has expired")
+	errInvitationMismatch = errors.New("invitation was sent to a different email address")
+)
+
+type InvitationController struct {
+	db     *gorm.DB
+	hub    *ws.Hub
+	mailer mailer.Mailer
+}
+
+func NewInvitationController(db *gorm.DB, hub *ws.Hub, mail mailer.Mailer) *InvitationController {
+	return &InvitationController{db: db, hub: hub, mailer: mail}
+}
+
+func invitationResponse(invitation models.TeamInvitation) gin.H {
+	return gin.H{
+		"id":          invitation.ID,
+		"team_id":     invitation.TeamID,
+		"email":       invitation.Email,
+		"role":        invitation.Role,
+		"invited_by":  invitation.InvitedBy,
+		"expires_at":  invitation.ExpiresAt,
+		"accepted_at": invitation.AcceptedAt,
+		"created_at":  invitation.CreatedAt,
+		"expired":     invitation.AcceptedAt == nil && invitation.ExpiresAt.Before(time.Now()),
+	}
+}
+
+// CreateInvitation emails an invitation to join a team
+func (ic *InvitationController) CreateInvitation(c *gin.Context) {
+	teamID := c.Param("id")
+
+	var input struct {
+		Email string                `json:"email" binding:"required,email"`
+		Role  models.TeamMemberRole `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role == "" {
+		input.Role = models.Editor
+	}
+	if !validRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+
+	var team models.Team
+	if err := ic.db.First(&team, "id = ?", teamID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+
+	userID := c.GetString("userID")
+	if input.Role == models.Owner && teamRole(c) != models.Owner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can invite owners"})
+		return
+	}
+
+	var memberCount int64
+	ic.db.Model(&models.TeamMember{}).
+		Joins("JOIN user ON user.id = team_member.user_id").
+		Where("team_member.team_id = ? AND user.email = ?", teamID, email).
+		Count(&memberCount)
+	if memberCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this team"})
+		return
+	}
+
+	token, err := utils.GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation"})
+		return
+	}
+
+	invitation := models.TeamInvitation{
+		ID:        uuid.New().String(),
+		TeamID:    teamID,
+		Email:     email,
+		Role:      input.Role,
+		TokenHash: utils.HashToken(token),
+		InvitedBy: userID,
+		ExpiresAt: time.Now().Add(InvitationTTL),
+	}
+
+	// A new invitation replaces any pending one for the same address
+	err = ic.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("team_id = ? AND email = ? AND accepted_at IS NULL", teamID, email).
+			Delete(&models.TeamInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	if err := ic.mailer.Send(invitationEmail(team, invitation, token)); err != nil {
+		log.Printf("Failed to send invitation to %s: %v", email, err)
+		ic.db.Delete(&invitation)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send invitation email"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitationResponse(invitation))
+}
+
+func invitationEmail(team models.Team, invitation models.TeamInvitation, token string) mailer.Message {
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:5173"
+	}
+	link := fmt.Sprintf("%s/invitations/%s", strings.TrimRight(appURL, "/"), token)
+
+	return mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You're invited to join %s", team.Name),
+		Body: fmt.Sprintf("You have been invited to join the team %q as %s.\n\n"+
+			"Accept the invitation here:\n%s\n\nThis link expires on %s.\n",
+			team.Name, invitation.Role, link, invitation.ExpiresAt.Format(time.RFC1123)),
+	}
+}
+
+// GetInvitations lists a team's invitations
+func (ic *InvitationController) GetInvitations(c *gin.Context) {
+	teamID := c.Param("id")
+
+	var invitations []models.TeamInvitation
+	query := ic.db.Where("team_id = ?", teamID)
+	if c.Query("status") != "all" {
+		query = query.Where("accepted_at IS NULL")
+	}
+	if err := query.Order("created_at DESC").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(invitations))
+	for _, invitation := range invitations {
+		result = append(result, invitationResponse(invitation))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RevokeInvitation cancels a pending invitation
+func (ic *InvitationController) RevokeInvitation(c *gin.Context) {
+	teamID := c.Param("id")
+	invitationID := c.Param("invitationId")
+
+	result := ic.db.Where("id = ? AND team_id = ? AND accepted_at IS NULL", invitationID, teamID).
+		Delete(&models.TeamInvitation{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// GetInvitation previews an invitation by token so the frontend can offer
+// to log in or register
+func (ic *InvitationController) GetInvitation(c *gin.Context) {
+	var invitation models.TeamInvitation
+	if err := ic.db.Preload("Team").
+		Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", utils.HashToken(c.Param("token")), time.Now()).
+		First(&invitation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errInvitationInvalid.Error()})
+		return
+	}
+
+	var userCount int64
+	ic.db.Model(&models.User{}).Where("email = ?", invitation.Email).Count(&userCount)
+
+	c.JSON(http.StatusOK, gin.H{
+		"team_id":     invitation.TeamID,
+		"team_name":   invitation.Team.Name,
+		"email":       invitation.Email,
+		"role":        invitation.Role,
+		"expires_at":  invitation.ExpiresAt,
+		"user_exists": userCount > 0,
+	})
+}
+
+// AcceptInvitation adds the current user to the inviting team
+func (ic *InvitationController) AcceptInvitation(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := ic.db.First(&user, "id = ?", c.GetString("userID")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var invitation *models.TeamInvitation
+	err := ic.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invitation, err = acceptInvitation(tx, input.Token, user)
+		return err
+	})
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	ic.hub.Publish(ws.TeamRoom(invitation.TeamID), "member_added", gin.H{"user_id": user.ID, "role": invitation.Role})
+	c.JSON(http.StatusOK, gin.H{"team_id": invitation.TeamID, "role": invitation.Role})
+}
+
+func respondInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errInvitationInvalid):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errInvitationMismatch):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+	}
+}
+
+// acceptInvitation redeems token for user inside tx, adding the membership
+// or upgrading an existing one to the invited role.
+func acceptInvitation(tx *gorm.DB, token string, user models.User) (*models.TeamInvitation, error) {
+	var invitation models.TeamInvitation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+		First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvitationInvalid
+		}
+		return nil, err
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		return nil, errInvitationMismatch
+	}
+
+	var member models.TeamMember
+	err := tx.Where("team_id = ? AND user_id = ?", invitation.TeamID, user.ID).First(&member).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = tx.Create(&models.TeamMember{
+			TeamID:   invitation.TeamID,
+			UserID:   user.ID,
+			Role:     invitation.Role,
+			JoinedAt: time.Now(),
+		}).Error
+	case err == nil && member.Role != models.Owner:
+		err = tx.Model(&models.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", invitation.TeamID, user.ID).
+			Update("role", invitation.Role).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invitation.AcceptedAt = &now
+	if err := tx.Model(&invitation).Update("accepted_at", now).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"website-builder/models"
+	"website-builder/policy"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// LockTTL is how long an element lock lasts unless it is renewed.
+	LockTTL = 30 * time.Second
+	// lockSweepInterval is how often expired locks are released.
+	lockSweepInterval = 10 * time.Second
+)
+
+type LockController struct {
+	db     *gorm.DB
+	hub    *ws.Hub
+	policy *policy.Policy
+}
+
+func NewLockController(db *gorm.DB, hub *ws.Hub) *LockController {
+	return &LockController{db: db, hub: hub, policy: policy.New(db)}
+}
+
+type lockInput struct {
+	ElementID string `json:"element_id"`
+}
+
+type lockInfo struct {
+	ElementID string    `json:"element_id"`
+	UserID    string    `json:"user_id"`
+	SocketID  string    `json:"socket_id"`
+	FullName  string    `json:"full_name"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func newLockInfo(lock models.ElementLock) lockInfo {
+	return lockInfo{
+		ElementID: lock.ElementID,
+		UserID:    lock.UserID,
+		SocketID:  lock.SocketID,
+		FullName:  lock.User.FullName,
+		ExpiresAt: lock.ExpiresAt,
+	}
+}
+
+// RegisterSocketHandlers lets clients take and release element locks and
+// frees a connection's locks when it leaves the project.
+func (lc *LockController) RegisterSocketHandlers() {
+	lc.hub.Handle("lock.acquire", lc.acquire)
+	lc.hub.Handle("lock.release", lc.release)
+	lc.hub.OnLeave(lc.releaseAll)
+}
+
+// authorize checks that the client may edit the project it sends a lock
+// message for. Viewers cannot edit, so they have no use for locks.
+func (lc *LockController) authorize(client *ws.Client, env *ws.Envelope) error {
+	if env.ProjectID == "" {
+		return ws.NewError(ws.ErrBadRequest, "project_id is required")
+	}
+	return authorizeSocket(lc.policy, client.UserID, policy.Edit,
+		policy.Resource{Kind: policy.Project, ID: env.ProjectID})
+}
+
+// acquire takes or renews the lock on an element for this connection.
+func (lc *LockController) acquire(client *ws.Client, env *ws.Envelope) (interface{}, error) {
+	if err := lc.authorize(client, env); err != nil {
+		return nil, err
+	}
+	var input lockInput
+	if err := env.Decode(&input); err != nil {
+		return nil, err
+	}
+	if input.ElementID == "" {
+		return nil, ws.NewError(ws.ErrBadRequest, "element_id is required")
+	}
+
+	var lock models.ElementLock
+	err := lc.db.Transaction(func(tx *gorm.DB) error {
+		var element models.Element
+		if err := tx.Preload("Page").First(&element, "id = ?", input.ElementID).Error; err != nil {
+			return notFoundOr(err, "element not found")
+		}
+		if element.Page.ProjectID != env.ProjectID {
+			return ws.NewError(ws.ErrForbidden, "element does not belong to project")
+		}
+
+		var existing models.ElementLock
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("User").
+			First(&existing, "element_id = ?", input.ElementID).Error
+		if err == nil && existing.SocketID != client.ID && existing.ExpiresAt.After(time.Now()) {
+			return ws.NewError(ws.ErrConflict, "element is being edited by "+existing.User.FullName)
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		lock = models.ElementLock{
+			ElementID: input.ElementID,
+			ProjectID: env.ProjectID,
+			UserID:    client.UserID,
+			SocketID:  client.ID,
+			ExpiresAt: time.Now().Add(LockTTL),
+		}
+		if err := tx.Save(&lock).Error; err != nil {
+			return err
+		}
+		return tx.Preload("User").First(&lock, "element_id = ?", lock.ElementID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := newLockInfo(lock)
+	lc.hub.Publish(ws.ProjectRoom(env.ProjectID), "lock.acquired", info)
+	return info, nil
+}
+
+func (lc *LockController) release(client *ws.Client, env *ws.Envelope) (interface{}, error) {
+	if err := lc.authorize(client, env); err != nil {
+		return nil, err
+	}
+	var input lockInput
+	if err := env.Decode(&input); err != nil {
+		return nil, err
+	}
+
+	result := lc.db.Where("element_id = ? AND socket_id = ?", input.ElementID, client.ID).
+		Delete(&models.ElementLock{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		lc.hub.Publish(ws.ProjectRoom(env.ProjectID), "lock.released", gin.H{"element_id": input.ElementID})
+	}
+	return nil, nil
+}
+
+func (lc *LockController) releaseAll(client *ws.Client, room string) {
+	kind, projectID, _ := ws.ParseRoom(room)
+	if kind != "project" {
+		return
+	}
+
+	var locks []models.ElementLock
+	if err := lc.db.Where("project_id = ? AND socket_id = ?", projectID, client.ID).
+		Find(&locks).Error; err != nil {
+		log.Printf("Failed to load locks: %v", err)
+		return
+	}
+	lc.releaseLocks(locks)
+}
+
+func (lc *LockController) releaseLocks(locks []models.ElementLock) {
+	for _, lock := range locks {
+		result := lc.db.Where("element_id = ? AND socket_id = ?", lock.ElementID, lock.SocketID).
+			Delete(&models.ElementLock{})
+		if result.Error != nil {
+			log.Printf("Failed to release lock: %v", result.Error)
+			continue
+		}
+		// Another replica's sweep may have released it first
+		if result.RowsAffected == 0 {
+			continue
+		}
+		lc.hub.Publish(ws.ProjectRoom(lock.ProjectID), "lock.released", gin.H{"element_id": lock.ElementID})
+	}
+}
+
+// ExpireLocks periodically releases locks that were not renewed in time.
+func (lc *LockController) ExpireLocks() {
+	ticker := time.NewTicker(lockSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var expired []models.ElementLock
+		if err := lc.db.Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+			log.Printf("Failed to load expired locks: %v", err)
+			continue
+		}
+		lc.releaseLocks(expired)
+	}
+}
+
+// GetLocks lists the active element locks of a project
+func (lc *LockController) GetLocks(c *gin.Context) {
+	projectID := c.Param("id")
+
+	var locks []models.ElementLock
+	if err := lc.db.Preload("User").
+		Where("project_id = ? AND expires_at > ?", projectID, time.Now()).
+		Find(&locks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locks"})
+		return
+	}
+
+	result := make([]lockInfo, 0, len(locks))
+	for _, lock := range locks {
+		result = append(result, newLockInfo(lock))
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// checkLocks rejects a change to any of elementIDs while another user holds
+// an unexpired lock on it.
+func checkLocks(tx *gorm.DB, elementIDs []string, userID string) error {
+	var lock models.ElementLock
+	err := tx.Preload("User").
+		Where("element_id IN ? AND user_id <> ? AND expires_at > ?", elementIDs, userID, time.Now()).
+		First(&lock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ws.NewError(ws.ErrConflict, "element is being edited by "+lock.User.FullName)
+}
@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"website-builder/models"
+	"website-builder/utils"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PageController struct {
+	db  *gorm.DB
+	hub *ws.Hub
+}
+
+func NewPageController(db *gorm.DB, hub *ws.Hub) *PageController {
+	return &PageController{db: db, hub: hub}
+}
+
+type pageInput struct {
+	Name           *string `json:"name" binding:"omitempty,max=100"`
+	Path           *string `json:"path"`
+	IsHomepage     *bool   `json:"is_homepage"`
+	SEOTitle       *string `json:"seo_title" binding:"omitempty,max=255"`
+	SEODescription *string `json:"seo_description"`
+	SEOKeywords    *string `json:"seo_keywords" binding:"omitempty,max=255"`
+}
+
+// normalizePagePath turns a user supplied path into "/segment/segment"
+// form, slugifying every segment. An empty result is the root path "/".
+func normalizePagePath(path string) string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if slug := utils.Slugify(segment); slug != "" {
+			segments = append(segments, slug)
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// lockProject serialises page changes within a project so path uniqueness
+// and the single homepage hold under concurrent requests.
+func lockProject(tx *gorm.DB, projectID string) error {
+	var project models.Project
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").First(&project, "id = ?", projectID).Error
+}
+
+// loadPageLocked loads a page after locking its project, so the row read
+// cannot change underneath the caller.
+func loadPageLocked(tx *gorm.DB, page *models.Page, pageID string) error {
+	if err := tx.Select("project_id").First(page, "id = ?", pageID).Error; err != nil {
+		return notFoundOr(err, "page not found")
+	}
+	if err := lockProject(tx, page.ProjectID); err != nil {
+		return err
+	}
+	return tx.First(page, "id = ?", pageID).Error
+}
+
+func checkPathAvailable(tx *gorm.DB, projectID string, path string, exceptID string) error {
+	var count int64
+	if err := tx.Model(&models.Page{}).
+		Where("project_id = ? AND path = ? AND id <> ?", projectID, path, exceptID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ws.NewError(ws.ErrConflict, "a page with path "+path+" already exists")
+	}
+	return nil
+}
+
+// setHomepage makes pageID the project's only homepage.
+func setHomepage(tx *gorm.DB, projectID string, pageID string) error {
+	if err := tx.Model(&models.Page{}).
+		Where("project_id = ? AND id <> ? AND is_homepage = ?", projectID, pageID, true).
+		Update("is_homepage", false).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Page{}).Where("id = ?", pageID).Update("is_homepage", true).Error
+}
+
+func (pgc *PageController) notifyProject(projectID string, event string, data interface{}) {
+	pgc.hub.Publish(ws.ProjectRoom(projectID), event, data)
+}
+
+// CreatePage adds a page at the end of a project's navigation. The first
+// page of a project always becomes its homepage.
+func (pgc *PageController) CreatePage(c *gin.Context) {
+	projectID := c.Param("id")
+
+	var input pageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Name == nil || strings.TrimSpace(*input.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	page := models.Page{
+		ID:        uuid.New().String(),
+		ProjectID: projectID,
+		Name:      strings.TrimSpace(*input.Name),
+	}
+	if input.Path != nil {
+		page.Path = normalizePagePath(*input.Path)
+	} else {
+		page.Path = normalizePagePath(page.Name)
+	}
+	applyPageSEO(&page, input)
+
+	err := pgc.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProject(tx, projectID); err != nil {
+			return notFoundOr(err, "project not found")
+		}
+		if err := checkPathAvailable(tx, projectID, page.Path, page.ID); err != nil {
+			return err
+		}
+
+		var siblings []models.Page
+		if err := tx.Select("position").Where("project_id = ?", projectID).
+			Order("position DESC").Limit(1).Find(&siblings).Error; err != nil {
+			return err
+		}
+		if len(siblings) > 0 {
+			page.Position = siblings[0].Position + 1
+		}
+		page.IsHomepage = len(siblings) == 0 || (input.IsHomepage != nil && *input.IsHomepage)
+
+		if err := tx.Create(&page).Error; err != nil {
+			return err
+		}
+		if page.IsHomepage {
+			return setHomepage(tx, projectID, page.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create page")
+		return
+	}
+
+	pgc.notifyProject(projectID, "page_created", page)
+	c.JSON(http.StatusCreated, page)
+}
+
+// GetPages lists a project's pages in navigation order
+func (pgc *PageController) GetPages(c *gin.Context) {
+	var pages []models.Page
+	if err := pgc.db.Where("project_id = ?", c.Param("id")).
+		Order("position").Order("created_at").
+		Find(&pages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pages)
+}
+
+func (pgc *PageController) GetPage(c *gin.Context) {
+	var page models.Page
+	if err := pgc.db.First(&page, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// UpdatePage renames a page, changes its path or SEO fields, or makes it
+// the homepage
+func (pgc *PageController) UpdatePage(c *gin.Context) {
+	pageID := c.Param("id")
+
+	var input pageInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var page models.Page
+	err := pgc.db.Transaction(func(tx *gorm.DB) error {
+		if err := loadPageLocked(tx, &page, pageID); err != nil {
+			return err
+		}
+
+		if input.Name != nil {
+			name := strings.TrimSpace(*input.Name)
+			if name == "" {
+				return ws.NewError(ws.ErrBadRequest, "name cannot be empty")
+			}
+			page.Name = name
+		}
+		if input.Path != nil {
+			page.Path = normalizePagePath(*input.Path)
+			if err := checkPathAvailable(tx, page.ProjectID, page.Path, page.ID); err != nil {
+				return err
+			}
+		}
+		if input.IsHomepage != nil {
+			if !*input.IsHomepage && page.IsHomepage {
+				return ws.NewError(ws.ErrBadRequest, "a project needs a homepage; mark another page as homepage instead")
+			}
+			if *input.IsHomepage && !page.IsHomepage {
+				if err := setHomepage(tx, page.ProjectID, page.ID); err != nil {
+					return err
+				}
+				page.IsHomepage = true
+			}
+		}
+		applyPageSEO(&page, input)
+
+		return tx.Save(&page).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update page")
+		return
+	}
+
+	pgc.notifyProject(page.ProjectID, "page_updated", page)
+	c.JSON(http.StatusOK, page)
+}
+
+// DeletePage deletes a page and its elements. Deleting the homepage hands
+// the role to the first remaining page.
+func (pgc *PageController) DeletePage(c *gin.Context) {
+	pageID := c.Param("id")
+
+	var page models.Page
+	err := pgc.db.Transaction(func(tx *gorm.DB) error {
+		if err := loadPageLocked(tx, &page, pageID); err != nil {
+			return err
+		}
+
+		var elementIDs []string
+		if err := tx.Model(&models.Element{}).Where("page_id = ?", page.ID).Pluck("id", &elementIDs).Error; err != nil {
+			return err
+		}
+		if len(elementIDs) > 0 {
+			if err := checkLocks(tx, elementIDs, c.GetString("userID")); err != nil {
+				return err
+			}
+		}
+		if err := deleteElements(tx, elementIDs); err != nil {
+			return err
+		}
+		if err := tx.Delete(&page).Error; err != nil {
+			return err
+		}
+
+		if !page.IsHomepage {
+			return nil
+		}
+		var next models.Page
+		err := tx.Where("project_id = ?", page.ProjectID).Order("position").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return setHomepage(tx, page.ProjectID, next.ID)
+	})
+	if err != nil {
+		respondError(c, err, "Failed to delete page")
+		return
+	}
+
+	pgc.notifyProject(page.ProjectID, "page_deleted", page.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Page deleted successfully"})
+}
+
+// ReorderPages sets the navigation order of a project's pages. Every page
+// of the project must be listed exactly once.
+func (pgc *PageController) ReorderPages(c *gin.Context) {
+	projectID := c.Param("id")
+
+	var input struct {
+		PageIDs []string `json:"page_ids" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var pages []models.Page
+	err := pgc.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProject(tx, projectID); err != nil {
+			return notFoundOr(err, "project not found")
+		}
+
+		var existing []string
+		if err := tx.Model(&models.Page{}).Where("project_id = ?", projectID).Pluck("id", &existing).Error; err != nil {
+			return err
+		}
+		if !sameIDs(existing, input.PageIDs) {
+			return ws.NewError(ws.ErrBadRequest, "page_ids must list every page of the project exactly once")
+		}
+
+		for position, id := range input.PageIDs {
+			if err := tx.Model(&models.Page{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("project_id = ?", projectID).Order("position").Find(&pages).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to reorder pages")
+		return
+	}
+
+	pgc.notifyProject(projectID, "pages_reordered", input.PageIDs)
+	c.JSON(http.StatusOK, pages)
+}
+
+func applyPageSEO(page *models.Page, input pageInput) {
+	if input.SEOTitle != nil {
+		page.SEOTitle = *input.SEOTitle
+	}
+	if input.SEODescription != nil {
+		page.SEODescription = *input.SEODescription
+	}
+	if input.SEOKeywords != nil {
+		page.SEOKeywords = *input.SEOKeywords
+	}
+}
+
+// sameIDs reports whether ordered is a permutation of ids.
+func sameIDs(ids []string, ordered []string) bool {
+	if len(ids) != len(ordered) {
+		return false
+	}
+	remaining := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remaining[id] = true
+	}
+	for _, id := range ordered {
+		if !remaining[id] {
+			return false
+		}
+		delete(remaining, id)
+	}
+	return true
+}
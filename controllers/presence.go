@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"website-builder/models"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// SessionTTL is how long a session survives without activity.
+	SessionTTL = 2 * time.Minute
+	// sessionSweepInterval is how often stale sessions are expired.
+	sessionSweepInterval = 30 * time.Second
+	// cursorTouchInterval is how often cursor moves refresh a session.
+	cursorTouchInterval = SessionTTL / 4
+)
+
+type PresenceController struct {
+	db  *gorm.DB
+	hub *ws.Hub
+}
+
+func NewPresenceController(db *gorm.DB, hub *ws.Hub) *PresenceController {
+	return &PresenceController{db: db, hub: hub}
+}
+
+type presenceUser struct {
+	UserID     string    `json:"user_id"`
+	SocketID   string    `json:"socket_id"`
+	FullName   string    `json:"full_name"`
+	Avatar     string    `json:"avatar"`
+	LastActive time.Time `json:"last_active"`
+}
+
+type cursorInput struct {
+	X         *int     `json:"x"`
+	Y         *int     `json:"y"`
+	Selection []string `json:"selection"`
+}
+
+// RegisterSocketHandlers tracks sessions for project rooms and relays
+// cursor and selection updates.
+func (prc *PresenceController) RegisterSocketHandlers() {
+	prc.hub.OnJoin(prc.join)
+	prc.hub.OnLeave(prc.leave)
+	prc.hub.Handle("presence.cursor", prc.cursor)
+	prc.hub.Handle("presence.heartbeat", prc.heartbeat)
+}
+
+func (prc *PresenceController) join(client *ws.Client, room string) {
+	kind, projectID, _ := ws.ParseRoom(room)
+	if kind != "project" {
+		return
+	}
+
+	session := models.Session{
+		ID:         uuid.New().String(),
+		ProjectID:  projectID,
+		UserID:     client.UserID,
+		SocketID:   client.ID,
+		LastActive: time.Now(),
+	}
+	if err := prc.db.Create(&session).Error; err != nil {
+		log.Printf("Failed to create session: %v", err)
+		return
+	}
+
+	prc.hub.Publish(room, "presence.join", prc.describe(session))
+}
+
+func (prc *PresenceController) leave(client *ws.Client, room string) {
+	kind, projectID, _ := ws.ParseRoom(room)
+	if kind != "project" {
+		return
+	}
+
+	if err := prc.db.Unscoped().
+		Where("project_id = ? AND socket_id = ?", projectID, client.ID).
+		Delete(&models.Session{}).Error; err != nil {
+		log.Printf("Failed to delete session: %v", err)
+	}
+
+	prc.hub.Publish(room, "presence.leave", gin.H{
+		"user_id":   client.UserID,
+		"socket_id": client.ID,
+	})
+}
+
+// touch refreshes the client's session, recreating it if it was expired
+// while the socket was still open.
+func (prc *PresenceController) touch(client *ws.Client, projectID string) {
+	result := prc.db.Model(&models.Session{}).
+		Where("project_id = ? AND socket_id = ?", projectID, client.ID).
+		Update("last_active", time.Now())
+	if result.Error != nil {
+		log.Printf("Failed to refresh session: %v", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		prc.join(client, ws.ProjectRoom(projectID))
+	}
+}
+
+func (prc *PresenceController) heartbeat(client *ws.Client, env *ws.Envelope) (interface{}, error) {
+	if env.ProjectID == "" {
+		return nil, ws.NewError(ws.ErrBadRequest, "project_id is required")
+	}
+	prc.touch(client, env.ProjectID)
+	return nil, nil
+}
+
+func (prc *PresenceController) cursor(client *ws.Client, env *ws.Envelope) (interface{}, error) {
+	if env.ProjectID == "" {
+		return nil, ws.NewError(ws.ErrBadRequest, "project_id is required")
+	}
+
+	var input cursorInput
+	if err := env.Decode(&input); err != nil {
+		return nil, err
+	}
+
+	// Cursors stream many frames a second, so only refresh the session now
+	// and then and leave the rest to heartbeats
+	if client.Due("session:"+env.ProjectID, cursorTouchInterval) {
+		prc.touch(client, env.ProjectID)
+	}
+
+	event, err := ws.NewEnvelope("presence.cursor", gin.H{
+		"user_id":   client.UserID,
+		"socket_id": client.ID,
+		"x":         input.X,
+		"y":         input.Y,
+		"selection": input.Selection,
+	})
+	if err != nil {
+		return nil, err
+	}
+	event.ProjectID = env.ProjectID
+	event.PageID = env.PageID
+	prc.hub.Post(&ws.Message{
+		Room:      ws.ProjectRoom(env.ProjectID),
+		Envelope:  event,
+		Sender:    client,
+		Except:    client,
+		Ephemeral: true,
+	})
+	return nil, nil
+}
+
+// ExpireSessions periodically removes sessions that have not been active
+// within SessionTTL and announces their departure.
+func (prc *PresenceController) ExpireSessions() {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		prc.expireStale()
+	}
+}
+
+func (prc *PresenceController) expireStale() {
+	var stale []models.Session
+	cutoff := time.Now().Add(-SessionTTL)
+	if err := prc.db.Where("last_active < ?", cutoff).Find(&stale).Error; err != nil {
+		log.Printf("Failed to load stale sessions: %v", err)
+		return
+	}
+
+	for _, session := range stale {
+		result := prc.db.Unscoped().Delete(&models.Session{}, "id = ?", session.ID)
+		if result.Error != nil {
+			log.Printf("Failed to expire session: %v", result.Error)
+			continue
+		}
+		// Another replica's sweep may have expired it first
+		if result.RowsAffected == 0 {
+			continue
+		}
+		prc.hub.Publish(ws.ProjectRoom(session.ProjectID), "presence.leave", gin.H{
+			"user_id":   session.UserID,
+			"socket_id": session.SocketID,
+		})
+	}
+}
+
+func (prc *PresenceController) describe(session models.Session) presenceUser {
+	entry := presenceUser{
+		UserID:     session.UserID,
+		SocketID:   session.SocketID,
+		LastActive: session.LastActive,
+	}
+
+	var user models.User
+	if err := prc.db.Select("id", "full_name", "avatar_url").
+		First(&user, "id = ?", session.UserID).Error; err == nil {
+		entry.FullName = user.FullName
+		entry.Avatar = user.AvatarURL
+	}
+	return entry
+}
+
+// GetPresence lists who is currently editing a project
+func (prc *PresenceController) GetPresence(c *gin.Context) {
+	projectID := c.Param("id")
+
+	var sessions []models.Session
+	if err := prc.db.Preload("User").
+		Where("project_id = ? AND last_active >= ?", projectID, time.Now().Add(-SessionTTL)).
+		Order("last_active DESC").
+		Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch presence"})
+		return
+	}
+
+	presence := make([]presenceUser, 0, len(sessions))
+	for _, session := range sessions {
+		presence = append(presence, presenceUser{
+			UserID:     session.UserID,
+			SocketID:   session.SocketID,
+			FullName:   session.User.FullName,
+			Avatar:     session.User.AvatarURL,
+			LastActive: session.LastActive,
+		})
+	}
+
+	c.JSON(http.StatusOK, presence)
+}
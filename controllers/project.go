@@ -1,11 +1,12 @@
 package controllers
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 
+	"website-builder/layout"
 	"website-builder/models"
+	"website-builder/policy"
 	ws "website-builder/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -14,12 +15,13 @@ import (
 )
 
 type ProjectController struct {
-	db  *gorm.DB
-	hub *ws.Hub
+	db     *gorm.DB
+	hub    *ws.Hub
+	policy *policy.Policy
 }
 
 func NewProjectController(db *gorm.DB, hub *ws.Hub) *ProjectController {
-	return &ProjectController{db: db, hub: hub}
+	return &ProjectController{db: db, hub: hub, policy: policy.New(db)}
 }
 
 func (pc *ProjectController) CreateProject(c *gin.Context) {
@@ -62,17 +64,15 @@ func (pc *ProjectController) GetProject(c *gin.Context) {
 	projectID := c.Param("id")
 
 	var project models.Project
-	if err := pc.db.Preload("Pages").Preload("Pages.Elements").
-		First(&project, "id = ?", projectID).Error; err != nil {
+	if err := pc.db.Preload("Page", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position").Order("created_at")
+	}).Preload("Page.Element", func(db *gorm.DB) *gorm.DB {
+		return db.Order("z_index").Order("created_at")
+	}).First(&project, "id = ?", projectID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
 		return
 	}
 
-	if !pc.hasTeamAccess(c, project.TeamID) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
 	c.JSON(http.StatusOK, project)
 }
 
@@ -83,12 +83,20 @@ func (pc *ProjectController) UpdateProject(c *gin.Context) {
 		Name   string               `json:"name"`
 		Status models.ProjectStatus `json:"status"`
 		Domain string               `json:"domain"`
+		// Breakpoints replaces the project's custom breakpoints
+		Breakpoints *models.Breakpoints `json:"breakpoints"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Breakpoints != nil {
+		if err := layout.Validate(*input.Breakpoints); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	var project models.Project
 	if err := pc.db.First(&project, "id = ?", projectID).Error; err != nil {
@@ -96,20 +104,24 @@ func (pc *ProjectController) UpdateProject(c *gin.Context) {
 		return
 	}
 
-	if !pc.hasTeamAccess(c, project.TeamID) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
 	if input.Name != "" {
 		project.Name = input.Name
 	}
-	if input.Status != "" {
+	if input.Status != "" && input.Status != project.Status {
+		// Taking a site live or offline needs more than edit rights
+		if (input.Status == models.Published || project.Status == models.Published) &&
+			!policy.Allows(teamRole(c), policy.Publish) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only owners and admins can publish"})
+			return
+		}
 		project.Status = input.Status
 	}
 	if input.Domain != "" {
 		project.Domain = input.Domain
 	}
+	if input.Breakpoints != nil {
+		project.Breakpoints = *input.Breakpoints
+	}
 
 	if err := pc.db.Save(&project).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
@@ -120,6 +132,8 @@ func (pc *ProjectController) UpdateProject(c *gin.Context) {
 	c.JSON(http.StatusOK, project)
 }
 
+// DeleteProject soft-deletes a project with its pages, elements, comments
+// and revisions; they are purged after DeletedRetention
 func (pc *ProjectController) DeleteProject(c *gin.Context) {
 	projectID := c.Param("id")
 
@@ -129,66 +143,80 @@ func (pc *ProjectController) DeleteProject(c *gin.Context) {
 		return
 	}
 
-	if !pc.hasTeamAccess(c, project.TeamID) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
-	if err := pc.db.Delete(&project).Error; err != nil {
+	if err := pc.db.Transaction(func(tx *gorm.DB) error {
+		return deleteProjects(tx, []string{project.ID})
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
 		return
 	}
 
 	pc.notifyTeam(project.TeamID, "project_deleted", project.ID)
+	pc.hub.Reauthorize(ws.ProjectRoom(project.ID))
 	c.JSON(http.StatusOK, gin.H{"message": "Project deleted successfully"})
 }
 
-func (pc *ProjectController) GetProjects(c *gin.Context) {
-	teamID := c.Query("team_id")
-	if teamID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "team_id parameter is required"})
-		return
+// TransferProject moves a project to another team the caller can edit in
+func (pc *ProjectController) TransferProject(c *gin.Context) {
+	projectID := c.Param("id")
+
+	var input struct {
+		TeamID string `json:"team_id" binding:"required"`
 	}
 
-	if !pc.hasTeamAccess(c, teamID) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var projects []models.Project
-	if err := pc.db.Where("team_id = ?", teamID).Find(&projects).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
+	var project models.Project
+	if err := pc.db.First(&project, "id = ?", projectID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return
+	}
+	if project.TeamID == input.TeamID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Project already belongs to this team"})
 		return
 	}
 
-	c.JSON(http.StatusOK, projects)
-}
-
-func (pc *ProjectController) hasTeamAccess(c *gin.Context, teamID string) bool {
-	userID, exists := c.Get("userID")
-	if !exists {
-		return false
+	allowed, _, err := pc.policy.Can(c.GetString("userID"), policy.Edit, policy.Resource{Kind: policy.Team, ID: input.TeamID})
+	if errors.Is(err, policy.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+	if err != nil || !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access to the target team denied"})
+		return
 	}
 
-	var count int64
-	pc.db.Model(&models.TeamMember{}).
-		Where("team_id = ? AND user_id = ?", teamID, userID).
-		Count(&count)
+	previousTeamID := project.TeamID
+	if err := pc.db.Model(&project).Update("team_id", input.TeamID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer project"})
+		return
+	}
 
-	return count > 0
+	pc.notifyTeam(previousTeamID, "project_deleted", project.ID)
+	pc.notifyTeam(project.TeamID, "project_created", project)
+	// Editors from the previous team lose access to the project
+	pc.hub.Reauthorize(ws.ProjectRoom(project.ID))
+	c.JSON(http.StatusOK, project)
 }
 
-func (pc *ProjectController) notifyTeam(teamID string, event string, data interface{}) {
-	message := map[string]interface{}{
-		"event": event,
-		"data":  data,
+func (pc *ProjectController) GetProjects(c *gin.Context) {
+	teamID := c.Query("team_id")
+	if teamID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "team_id parameter is required"})
+		return
 	}
 
-	jsonMessage, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Failed to marshal notification message: %v", err)
+	var projects []models.Project
+	if err := pc.db.Where("team_id = ?", teamID).Find(&projects).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch projects"})
 		return
 	}
 
-	pc.hub.Broadcast <- jsonMessage
+	c.JSON(http.StatusOK, projects)
+}
+
+func (pc *ProjectController) notifyTeam(teamID string, event string, data interface{}) {
+	pc.hub.Publish(ws.TeamRoom(teamID), event, data)
 }
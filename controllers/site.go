@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"website-builder/render"
+	"website-builder/utils"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewProject renders one page of a project as it would be published,
+// the homepage unless ?path= names another
+func (pc *ProjectController) PreviewProject(c *gin.Context) {
+	site, err := render.LoadAndRender(pc.db, c.Param("id"))
+	if err != nil {
+		respondError(c, renderError(err), "Failed to render project")
+		return
+	}
+
+	page, ok := site.Homepage()
+	if path := c.Query("path"); path != "" {
+		page, ok = site.Find(normalizePagePath(path))
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.HTML)
+}
+
+// ExportProject renders a project to static files and returns them as a
+// zip archive
+func (pc *ProjectController) ExportProject(c *gin.Context) {
+	site, err := render.LoadAndRender(pc.db, c.Param("id"))
+	if err != nil {
+		respondError(c, renderError(err), "Failed to render project")
+		return
+	}
+
+	name := utils.Slugify(site.Name)
+	if name == "" {
+		name = "site"
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+	c.Status(http.StatusOK)
+	if err := site.WriteZip(c.Writer); err != nil {
+		c.Error(err)
+	}
+}
+
+// renderError maps a failure to render a project to the error reported
+// to the client.
+func renderError(err error) error {
+	if errors.Is(err, render.ErrPathConflict) {
+		return ws.NewError(ws.ErrConflict, err.Error())
+	}
+	return notFoundOr(err, "project not found")
+}
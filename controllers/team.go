@@ -0,0 +1,383 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"website-builder/models"
+	"website-builder/policy"
+	ws "website-builder/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TeamController struct {
+	db  *gorm.DB
+	hub *ws.Hub
+}
+
+func NewTeamController(db *gorm.DB, hub *ws.Hub) *TeamController {
+	return &TeamController{db: db, hub: hub}
+}
+
+var errLastOwner = errors.New("a team must keep at least one owner")
+
+func validRole(role models.TeamMemberRole) bool {
+	switch role {
+	case models.Owner, models.Admin, models.Editor, models.Viewer:
+		return true
+	}
+	return false
+}
+
+func (tc *TeamController) CreateTeam(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("userID")
+	team := models.Team{
+		ID:        uuid.New().String(),
+		Name:      input.Name,
+		CreatedBy: userID,
+	}
+
+	// The creator becomes the team's first owner
+	err := tc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&team).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TeamMember{
+			TeamID:   team.ID,
+			UserID:   userID,
+			Role:     models.Owner,
+			JoinedAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create team"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, team)
+}
+
+// GetTeams lists the teams the current user belongs to
+func (tc *TeamController) GetTeams(c *gin.Context) {
+	var members []models.TeamMember
+	if err := tc.db.Preload("Team").
+		Where("user_id = ?", c.GetString("userID")).
+		Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch teams"})
+		return
+	}
+
+	teams := make([]gin.H, 0, len(members))
+	for _, member := range members {
+		teams = append(teams, gin.H{
+			"id":         member.Team.ID,
+			"name":       member.Team.Name,
+			"created_by": member.Team.CreatedBy,
+			"created_at": member.Team.CreatedAt,
+			"role":       member.Role,
+		})
+	}
+
+	c.JSON(http.StatusOK, teams)
+}
+
+func (tc *TeamController) GetTeam(c *gin.Context) {
+	teamID := c.Param("id")
+
+	var team models.Team
+	if err := tc.db.First(&team, "id = ?", teamID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         team.ID,
+		"name":       team.Name,
+		"created_by": team.CreatedBy,
+		"created_at": team.CreatedAt,
+		"role":       teamRole(c),
+	})
+}
+
+func (tc *TeamController) UpdateTeam(c *gin.Context) {
+	teamID := c.Param("id")
+
+	var input struct {
+		Name string `json:"name" binding:"required,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var team models.Team
+	if err := tc.db.First(&team, "id = ?", teamID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+
+	team.Name = input.Name
+	if err := tc.db.Save(&team).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update team"})
+		return
+	}
+
+	tc.hub.Publish(ws.TeamRoom(team.ID), "team_updated", team)
+	c.JSON(http.StatusOK, team)
+}
+
+// DeleteTeam soft-deletes a team, its memberships and all of its projects;
+// they are purged after DeletedRetention
+func (tc *TeamController) DeleteTeam(c *gin.Context) {
+	teamID := c.Param("id")
+
+	var team models.Team
+	if err := tc.db.First(&team, "id = ?", teamID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+
+	// The projects are looked up first, as deleting hides them
+	rooms := teamRooms(tc.db, team.ID)
+	if err := tc.db.Transaction(func(tx *gorm.DB) error {
+		return deleteTeam(tx, team.ID)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete team"})
+		return
+	}
+
+	tc.hub.Publish(ws.TeamRoom(team.ID), "team_deleted", team.ID)
+	tc.hub.Reauthorize(rooms...)
+	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
+}
+
+func (tc *TeamController) GetMembers(c *gin.Context) {
+	teamID := c.Param("id")
+
+	var members []models.TeamMember
+	if err := tc.db.Preload("User").
+		Where("team_id = ?", teamID).
+		Order("joined_at").
+		Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(members))
+	for _, member := range members {
+		result = append(result, memberResponse(member))
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (tc *TeamController) UpdateMemberRole(c *gin.Context) {
+	teamID := c.Param("id")
+	memberID := c.Param("userId")
+
+	var input struct {
+		Role models.TeamMemberRole `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	actorRole := teamRole(c)
+
+	var member models.TeamMember
+	err := tc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&member, "team_id = ? AND user_id = ?", teamID, memberID).Error; err != nil {
+			return err
+		}
+
+		// Only owners may grant or take away ownership
+		if (member.Role == models.Owner || input.Role == models.Owner) && actorRole != models.Owner {
+			return ws.NewError(ws.ErrForbidden, "only owners can change ownership")
+		}
+		if member.Role == models.Owner && input.Role != models.Owner {
+			if err := ensureAnotherOwner(tx, teamID, memberID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", teamID, memberID).
+			Update("role", input.Role).Error
+	})
+	if err != nil {
+		respondMemberError(c, err, "Failed to update member")
+		return
+	}
+
+	tc.hub.Publish(ws.TeamRoom(teamID), "member_updated", gin.H{"user_id": memberID, "role": input.Role})
+	tc.hub.Reauthorize(teamRooms(tc.db, teamID)...)
+	c.JSON(http.StatusOK, gin.H{"user_id": memberID, "role": input.Role})
+}
+
+// TransferOwnership makes another member an owner and steps the caller down
+// to admin
+func (tc *TeamController) TransferOwnership(c *gin.Context) {
+	teamID := c.Param("id")
+	userID := c.GetString("userID")
+
+	var input struct {
+		UserID string `json:"user_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.UserID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already own this team"})
+		return
+	}
+
+	err := tc.db.Transaction(func(tx *gorm.DB) error {
+		var member models.TeamMember
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&member, "team_id = ? AND user_id = ?", teamID, input.UserID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", teamID, input.UserID).
+			Update("role", models.Owner).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.TeamMember{}).
+			Where("team_id = ? AND user_id = ?", teamID, userID).
+			Update("role", models.Admin).Error
+	})
+	if err != nil {
+		respondMemberError(c, err, "Failed to transfer ownership")
+		return
+	}
+
+	tc.hub.Publish(ws.TeamRoom(teamID), "member_updated", gin.H{"user_id": input.UserID, "role": models.Owner})
+	tc.hub.Publish(ws.TeamRoom(teamID), "member_updated", gin.H{"user_id": userID, "role": models.Admin})
+	c.JSON(http.StatusOK, gin.H{"owner_id": input.UserID})
+}
+
+// RemoveMember removes a member from a team
+func (tc *TeamController) RemoveMember(c *gin.Context) {
+	teamID := c.Param("id")
+	memberID := c.Param("userId")
+	userID := c.GetString("userID")
+
+	// Any member may leave; removing someone else needs ManageMembers
+	actorRole := teamRole(c)
+	if memberID != userID && !policy.Allows(actorRole, policy.ManageMembers) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	err := tc.db.Transaction(func(tx *gorm.DB) error {
+		var member models.TeamMember
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&member, "team_id = ? AND user_id = ?", teamID, memberID).Error; err != nil {
+			return err
+		}
+
+		if member.Role == models.Owner {
+			if memberID != userID && actorRole != models.Owner {
+				return ws.NewError(ws.ErrForbidden, "only owners can remove an owner")
+			}
+			if err := ensureAnotherOwner(tx, teamID, memberID); err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("team_id = ? AND user_id = ?", teamID, memberID).
+			Delete(&models.TeamMember{}).Error
+	})
+	if err != nil {
+		respondMemberError(c, err, "Failed to remove member")
+		return
+	}
+
+	tc.hub.Publish(ws.TeamRoom(teamID), "member_removed", gin.H{"user_id": memberID})
+	tc.hub.Reauthorize(teamRooms(tc.db, teamID)...)
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// teamRooms returns the rooms of a team and of its projects, whose members
+// must be re-checked when access to the team changes.
+func teamRooms(db *gorm.DB, teamID string) []string {
+	rooms := []string{ws.TeamRoom(teamID)}
+	var projectIDs []string
+	if err := db.Model(&models.Project{}).Where("team_id = ?", teamID).Pluck("id", &projectIDs).Error; err != nil {
+		log.Printf("Failed to load team projects: %v", err)
+	}
+	for _, projectID := range projectIDs {
+		rooms = append(rooms, ws.ProjectRoom(projectID))
+	}
+	return rooms
+}
+
+// ensureAnotherOwner fails unless the team has an owner besides userID. The
+// owner rows are locked so concurrent demotions cannot both succeed.
+func ensureAnotherOwner(tx *gorm.DB, teamID string, userID string) error {
+	var owners []models.TeamMember
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("team_id = ? AND role = ? AND user_id <> ?", teamID, models.Owner, userID).
+		Find(&owners).Error; err != nil {
+		return err
+	}
+	if len(owners) == 0 {
+		return errLastOwner
+	}
+	return nil
+}
+
+func respondMemberError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+	case errors.Is(err, errLastOwner):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondError(c, err, fallback)
+	}
+}
+
+func memberResponse(member models.TeamMember) gin.H {
+	return gin.H{
+		"user_id":   member.UserID,
+		"email":     member.User.Email,
+		"full_name": member.User.FullName,
+		"avatar":    member.User.AvatarURL,
+		"role":      member.Role,
+		"joined_at": member.JoinedAt,
+	}
+}
+
+// teamRole returns the caller's role in the team owning the requested
+// resource, as resolved by the policy middleware.
+func teamRole(c *gin.Context) models.TeamMemberRole {
+	role, _ := c.Value(policy.RoleKey).(models.TeamMemberRole)
+	return role
+}
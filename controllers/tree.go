@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"website-builder/layout"
+	"website-builder/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ElementNode is an element with its children nested beneath it.
+type ElementNode struct {
+	ID              string             `json:"id"`
+	Type            models.ElementType `json:"type"`
+	Data            models.JSON        `json:"data"`
+	PositionX       int                `json:"position_x"`
+	PositionY       int                `json:"position_y"`
+	Width           int                `json:"width"`
+	Height          int                `json:"height"`
+	ZIndex          int                `json:"z_index"`
+	ParentElementID *string            `json:"parent_element_id"`
+	Hidden          bool               `json:"hidden"`
+	// Overrides are the element's own per-breakpoint changes and Layouts
+	// its resolved box at every breakpoint.
+	Overrides models.Layouts        `json:"overrides,omitempty"`
+	Layouts   map[string]layout.Box `json:"layouts"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	Children  []*ElementNode        `json:"children"`
+}
+
+type PageNode struct {
+	ID             string         `json:"id"`
+	Name           string         `json:"name"`
+	Path           string         `json:"path"`
+	IsHomepage     bool           `json:"is_homepage"`
+	Position       int            `json:"position"`
+	SEOTitle       string         `json:"seo_title"`
+	SEODescription string         `json:"seo_description"`
+	SEOKeywords    string         `json:"seo_keywords"`
+	ElementSeq     uint64         `json:"element_seq"`
+	Elements       []*ElementNode `json:"elements"`
+}
+
+// ComponentTree is a component with its elements nested like a page's.
+type ComponentTree struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	Version  int            `json:"version"`
+	Elements []*ElementNode `json:"elements"`
+}
+
+// ProjectTree is a project with its pages and their element hierarchies,
+// and the components placed on them, as loaded by the editor.
+type ProjectTree struct {
+	ID           string               `json:"id"`
+	Name         string               `json:"name"`
+	TeamID       string               `json:"team_id"`
+	Status       models.ProjectStatus `json:"status"`
+	Domain       string               `json:"domain"`
+	PublishedURL string               `json:"published_url"`
+	UpdatedAt    time.Time            `json:"updated_at"`
+	Breakpoints  models.Breakpoints   `json:"breakpoints"`
+	Pages        []*PageNode          `json:"pages"`
+	Components   []*ComponentTree     `json:"components"`
+}
+
+// GetProjectTree returns a project's pages in navigation order, each with
+// its nested elements ordered by z-index. With ?breakpoint= every element
+// is given its box at that breakpoint and hidden elements are left out.
+func (pc *ProjectController) GetProjectTree(c *gin.Context) {
+	tree, err := loadProjectTree(pc.db, c.Param("id"))
+	if err != nil {
+		respondError(c, notFoundOr(err, "project not found"), "Failed to load project")
+		return
+	}
+
+	if breakpoint := c.Query("breakpoint"); breakpoint != "" {
+		if !layout.Has(tree.Breakpoints, breakpoint) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown breakpoint " + breakpoint})
+			return
+		}
+		for _, page := range tree.Pages {
+			page.Elements = atBreakpoint(page.Elements, breakpoint)
+		}
+		for _, component := range tree.Components {
+			component.Elements = atBreakpoint(component.Elements, breakpoint)
+		}
+	}
+
+	c.JSON(http.StatusOK, tree)
+}
+
+// loadProjectTree loads a project in four queries, one each for the
+// project, its pages, all of their elements and its components, and nests
+// the elements in memory.
+func loadProjectTree(db *gorm.DB, projectID string) (*ProjectTree, error) {
+	var project models.Project
+	if err := db.First(&project, "id = ?", projectID).Error; err != nil {
+		return nil, err
+	}
+
+	var pages []models.Page
+	if err := db.Where("project_id = ?", projectID).
+		Order("position").Order("created_at").
+		Find(&pages).Error; err != nil {
+		return nil, err
+	}
+
+	tree := &ProjectTree{
+		ID:           project.ID,
+		Name:         project.Name,
+		TeamID:       project.TeamID,
+		Status:       project.Status,
+		Domain:       project.Domain,
+		PublishedURL: project.PublishedURL,
+		UpdatedAt:    project.UpdatedAt,
+		Breakpoints:  layout.Resolve(project.Breakpoints),
+		Pages:        make([]*PageNode, 0, len(pages)),
+	}
+
+	var components []models.Component
+	if err := db.Where("project_id = ?", projectID).Order("name").Find(&components).Error; err != nil {
+		return nil, err
+	}
+	tree.Components = make([]*ComponentTree, 0, len(components))
+	for _, component := range components {
+		nodes := make([]models.Element, 0, len(component.Elements))
+		for _, node := range component.Elements {
+			nodes = append(nodes, models.Element{
+				ID:              node.ID,
+				Type:            node.Type,
+				Data:            node.Data,
+				PositionX:       node.PositionX,
+				PositionY:       node.PositionY,
+				Width:           node.Width,
+				Height:          node.Height,
+				ZIndex:          node.ZIndex,
+				ParentElementID: node.ParentElementID,
+				UpdatedAt:       component.UpdatedAt,
+			})
+		}
+		tree.Components = append(tree.Components, &ComponentTree{
+			ID:       component.ID,
+			Name:     component.Name,
+			Width:    component.Width,
+			Height:   component.Height,
+			Version:  component.Version,
+			Elements: buildElementTree(nodes, tree.Breakpoints),
+		})
+	}
+
+	if len(pages) == 0 {
+		return tree, nil
+	}
+
+	pageIDs := make([]string, 0, len(pages))
+	for _, page := range pages {
+		pageIDs = append(pageIDs, page.ID)
+	}
+
+	var elements []models.Element
+	if err := db.Where("page_id IN ?", pageIDs).
+		Order("z_index").Order("created_at").
+		Find(&elements).Error; err != nil {
+		return nil, err
+	}
+
+	byPage := make(map[string][]models.Element, len(pages))
+	for _, element := range elements {
+		byPage[element.PageID] = append(byPage[element.PageID], element)
+	}
+
+	for _, page := range pages {
+		tree.Pages = append(tree.Pages, &PageNode{
+			ID:             page.ID,
+			Name:           page.Name,
+			Path:           page.Path,
+			IsHomepage:     page.IsHomepage,
+			Position:       page.Position,
+			SEOTitle:       page.SEOTitle,
+			SEODescription: page.SEODescription,
+			SEOKeywords:    page.SEOKeywords,
+			ElementSeq:     page.ElementSeq,
+			Elements:       buildElementTree(byPage[page.ID], tree.Breakpoints),
+		})
+	}
+	return tree, nil
+}
+
+// buildElementTree nests a page's elements under their parents. Elements
+// whose parent is missing from the page are treated as roots. The input
+// order, by z-index, is kept among siblings.
+func buildElementTree(elements []models.Element, breakpoints models.Breakpoints) []*ElementNode {
+	nodes := make(map[string]*ElementNode, len(elements))
+	for _, element := range elements {
+		layouts := layout.Cascade(breakpoints, layout.Base(&element), element.Layouts)
+		nodes[element.ID] = &ElementNode{
+			ID:              element.ID,
+			Type:            element.Type,
+			Data:            element.Data,
+			PositionX:       element.PositionX,
+			PositionY:       element.PositionY,
+			Width:           element.Width,
+			Height:          element.Height,
+			ZIndex:          element.ZIndex,
+			ParentElementID: element.ParentElementID,
+			Hidden:          layouts[layout.Desktop].Hidden,
+			Overrides:       element.Layouts,
+			Layouts:         layouts,
+			UpdatedAt:       element.UpdatedAt,
+			Children:        []*ElementNode{},
+		}
+	}
+
+	roots := []*ElementNode{}
+	for _, element := range elements {
+		node := nodes[element.ID]
+		if element.ParentElementID != nil {
+			if parent, ok := nodes[*element.ParentElementID]; ok && parent != node {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	// The query already orders by z-index; keep it stable should callers
+	// pass elements in another order
+	sortNodes(roots)
+	return roots
+}
+
+// atBreakpoint gives every node its box at breakpoint and drops the nodes
+// hidden there, together with their children.
+func atBreakpoint(nodes []*ElementNode, breakpoint string) []*ElementNode {
+	visible := make([]*ElementNode, 0, len(nodes))
+	for _, node := range nodes {
+		box := node.Layouts[breakpoint]
+		if box.Hidden {
+			continue
+		}
+		node.PositionX, node.PositionY = box.PositionX, box.PositionY
+		node.Width, node.Height = box.Width, box.Height
+		node.ZIndex = box.ZIndex
+		node.Children = atBreakpoint(node.Children, breakpoint)
+		visible = append(visible, node)
+	}
+	sort.SliceStable(visible, func(i, j int) bool { return visible[i].ZIndex < visible[j].ZIndex })
+	return visible
+}
+
+func sortNodes(nodes []*ElementNode) {
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].ZIndex < nodes[j].ZIndex })
+	for _, node := range nodes {
+		sortNodes(node.Children)
+	}
+}
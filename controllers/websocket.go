@@ -1,42 +1,154 @@
 package controllers
 
 import (
+	"errors"
 	"log"
+	"net/http"
+	"time"
 
+	"website-builder/models"
+	"website-builder/policy"
+	"website-builder/utils"
 	ws "website-builder/websocket"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+// TicketTTL is how long a WebSocket ticket can be redeemed.
+const TicketTTL = 30 * time.Second
+
+type WebSocketController struct {
+	db       *gorm.DB
+	hub      *ws.Hub
+	upgrader websocket.Upgrader
+}
+
+func NewWebSocketController(db *gorm.DB, hub *ws.Hub, allowedOrigins []string) *WebSocketController {
+	return &WebSocketController{
+		db:  db,
+		hub: hub,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			Subprotocols:    []string{ws.Subprotocol},
+			CheckOrigin:     originChecker(allowedOrigins),
+		},
+	}
+}
+
+// originChecker accepts handshakes without an Origin header (non-browser
+// clients) or from one of the configured CORS origins.
+func originChecker(allowedOrigins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[origin] = true
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowed["*"] || allowed[origin] {
+			return true
+		}
+		log.Printf("Rejected WebSocket handshake from origin %s", origin)
+		return false
+	}
 }
 
-func WebSocketHandler(c *gin.Context, hub *ws.Hub) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+func (wc *WebSocketController) Connect(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	conn, err := wc.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade to WebSocket: %v", err)
 		return
 	}
 
+	client := ws.NewClient(uuid.New().String(), conn, userID.(string), wc.hub.Config)
+	wc.hub.Serve(client)
+}
+
+// IssueTicket hands out a single-use ticket for opening a WebSocket
+func (wc *WebSocketController) IssueTicket(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
-		conn.WriteMessage(websocket.CloseMessage, []byte("Unauthorized"))
-		conn.Close()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	client := &ws.Client{
-		Conn:   conn,
-		UserID: userID.(string),
-		Send:   make(chan []byte, 256),
+	ticket, err := utils.GenerateToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate ticket"})
+		return
 	}
 
-	hub.Register <- client
+	record := models.SocketTicket{
+		ID:        utils.HashToken(ticket),
+		UserID:    userID.(string),
+		ExpiresAt: time.Now().Add(TicketTTL),
+	}
 
-	go client.WritePump()
-	go client.ReadPump(hub)
+	// Clear out tickets nobody redeemed
+	wc.db.Where("expires_at < ?", time.Now()).Delete(&models.SocketTicket{})
+
+	if err := wc.db.Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ticket"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ticket":     ticket,
+		"expires_at": record.ExpiresAt,
+	})
+}
+
+// RedeemTicket consumes a ticket, returning the user it was issued to.
+func (wc *WebSocketController) RedeemTicket(ticket string) (string, bool) {
+	var record models.SocketTicket
+	if err := wc.db.First(&record, "id = ?", utils.HashToken(ticket)).Error; err != nil {
+		return "", false
+	}
+
+	// Only the request that actually deletes the row wins
+	result := wc.db.Where("id = ? AND expires_at > ?", record.ID, time.Now()).Delete(&models.SocketTicket{})
+	if result.Error != nil || result.RowsAffected != 1 {
+		return "", false
+	}
+	return record.UserID, true
 }
 
+// RoomAuthorizer only lets users who may view a team or project join its
+// room.
+func RoomAuthorizer(p *policy.Policy) ws.RoomAuthorizer {
+	return func(userID string, room string) bool {
+		kind, id, ok := ws.ParseRoom(room)
+		if !ok {
+			return false
+		}
+
+		allowed, _, err := p.Can(userID, policy.View, policy.Resource{Kind: policy.Kind(kind), ID: id})
+		return err == nil && allowed
+	}
+}
+
+// authorizeSocket checks a socket frame against the policy, reporting a
+// denial as a protocol error.
+func authorizeSocket(p *policy.Policy, userID string, action policy.Action, res policy.Resource) error {
+	allowed, _, err := p.Can(userID, action, res)
+	if errors.Is(err, policy.ErrNotFound) {
+		return ws.NewError(ws.ErrNotFound, string(res.Kind)+" not found")
+	}
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ws.NewError(ws.ErrForbidden, "you do not have permission to "+string(action)+" this "+string(res.Kind))
+	}
+	return nil
+}
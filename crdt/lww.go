@@ -0,0 +1,81 @@
+// Package crdt holds the merge rules used to converge concurrent element
+// edits. Every field of an element is a last-writer-wins register stamped
+// with a Lamport timestamp, so replicas that see the same set of writes end
+// up with the same value regardless of delivery order.
+package crdt
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// Timestamp is a Lamport clock value. Node identifies the writer and breaks
+// ties between writes that carry the same clock.
+type Timestamp struct {
+	Clock uint64 `json:"c"`
+	Node  string `json:"n"`
+}
+
+// Less orders timestamps by clock, then by node.
+func (t Timestamp) Less(other Timestamp) bool {
+	if t.Clock != other.Clock {
+		return t.Clock < other.Clock
+	}
+	return t.Node < other.Node
+}
+
+// Clocks maps a field name to the timestamp of the write that set it.
+type Clocks map[string]Timestamp
+
+// Max returns the highest clock value recorded for any field.
+func (c Clocks) Max() uint64 {
+	var max uint64
+	for _, ts := range c {
+		if ts.Clock > max {
+			max = ts.Clock
+		}
+	}
+	return max
+}
+
+// MaxSkew is how far past the highest clock of an element a write may be
+// stamped. Lamport clocks only need to move one past what the writer has
+// seen; the slack allows for writes the server has not received yet.
+const MaxSkew = 1 << 20
+
+// Admits reports whether a write stamped with clock may be applied. A
+// write far in the future would win every register for good, and a clock
+// near the top of the range would leave no room for later writes.
+func (c Clocks) Admits(clock uint64) bool {
+	return clock <= c.Max()+MaxSkew
+}
+
+// Set records ts for field and reports whether the write wins. A write
+// loses when the field already holds a value from a later timestamp.
+func (c Clocks) Set(field string, ts Timestamp) bool {
+	if current, ok := c[field]; ok && !current.Less(ts) {
+		return false
+	}
+	c[field] = ts
+	return true
+}
+
+func (c *Clocks) Scan(value interface{}) error {
+	if value == nil {
+		*c = nil
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, c)
+}
+
+func (c Clocks) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return json.Marshal(c)
+}
@@ -0,0 +1,84 @@
+package crdt
+
+// DataPrefix namespaces the clocks of individual keys of an element's Data.
+const DataPrefix = "data."
+
+// Result lists which fields of a write took effect.
+type Result struct {
+	Applied  []string `json:"applied,omitempty"`
+	Rejected []string `json:"rejected,omitempty"`
+}
+
+func (r *Result) record(field string, won bool) bool {
+	if won {
+		r.Applied = append(r.Applied, field)
+	} else {
+		r.Rejected = append(r.Rejected, field)
+	}
+	return won
+}
+
+// SetInt applies a write to an integer register.
+func (r *Result) SetInt(clocks Clocks, field string, target *int, value *int, ts Timestamp) {
+	if value == nil {
+		return
+	}
+	if r.record(field, clocks.Set(field, ts)) {
+		*target = *value
+	}
+}
+
+// SetOptionalInt applies a write to an integer register that may be unset.
+func (r *Result) SetOptionalInt(clocks Clocks, field string, target **int, value *int, ts Timestamp) {
+	if value == nil {
+		return
+	}
+	if r.record(field, clocks.Set(field, ts)) {
+		v := *value
+		*target = &v
+	}
+}
+
+// SetOptionalBool applies a write to a boolean register that may be unset.
+func (r *Result) SetOptionalBool(clocks Clocks, field string, target **bool, value *bool, ts Timestamp) {
+	if value == nil {
+		return
+	}
+	if r.record(field, clocks.Set(field, ts)) {
+		v := *value
+		*target = &v
+	}
+}
+
+// Clear records a write that unsets field and reports whether it won.
+func (r *Result) Clear(clocks Clocks, field string, ts Timestamp) bool {
+	return r.record(field, clocks.Set(field, ts))
+}
+
+// SetRef applies a write to an optional reference, where a nil value
+// clears it.
+func (r *Result) SetRef(clocks Clocks, field string, target **string, value *string, ts Timestamp) {
+	if r.record(field, clocks.Set(field, ts)) {
+		*target = value
+	}
+}
+
+// MergeData applies patch to data key by key. A nil value removes the key
+// but keeps its timestamp so an older write cannot bring it back.
+func (r *Result) MergeData(clocks Clocks, data map[string]interface{}, patch map[string]interface{}, ts Timestamp) {
+	for key, value := range patch {
+		if !r.record(DataPrefix+key, clocks.Set(DataPrefix+key, ts)) {
+			continue
+		}
+		if value == nil {
+			delete(data, key)
+		} else {
+			data[key] = value
+		}
+	}
+}
+
+// Changed reports whether any field was applied.
+func (r *Result) Changed() bool {
+	return len(r.Applied) > 0
+}
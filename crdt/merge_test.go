@@ -0,0 +1,204 @@
+package crdt
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// replica is the state of one element as a client holds it.
+type replica struct {
+	clocks    Clocks
+	data      map[string]interface{}
+	positionX int
+	positionY int
+	width     int
+	height    int
+	zIndex    int
+	parent    *string
+}
+
+func newReplica() *replica {
+	return &replica{clocks: Clocks{}, data: map[string]interface{}{}}
+}
+
+// op is a write from one simulated client. Nil fields are left alone.
+type op struct {
+	ts        Timestamp
+	data      map[string]interface{}
+	positionX *int
+	positionY *int
+	width     *int
+	height    *int
+	zIndex    *int
+	parent    *string
+	reparent  bool
+}
+
+func (r *replica) apply(o op) {
+	var result Result
+	result.SetInt(r.clocks, "position_x", &r.positionX, o.positionX, o.ts)
+	result.SetInt(r.clocks, "position_y", &r.positionY, o.positionY, o.ts)
+	result.SetInt(r.clocks, "width", &r.width, o.width, o.ts)
+	result.SetInt(r.clocks, "height", &r.height, o.height, o.ts)
+	result.SetInt(r.clocks, "z_index", &r.zIndex, o.zIndex, o.ts)
+	if o.reparent {
+		result.SetRef(r.clocks, "parent_element_id", &r.parent, o.parent, o.ts)
+	}
+	if o.data != nil {
+		result.MergeData(r.clocks, r.data, o.data, o.ts)
+	}
+}
+
+func intPtr(n int) *int       { return &n }
+func strPtr(s string) *string { return &s }
+
+// permutations calls visit with every ordering of n indexes.
+func permutations(n int, visit func([]int)) {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	var permute func(k int)
+	permute = func(k int) {
+		if k == n {
+			visit(order)
+			return
+		}
+		for i := k; i < n; i++ {
+			order[k], order[i] = order[i], order[k]
+			permute(k + 1)
+			order[k], order[i] = order[i], order[k]
+		}
+	}
+	permute(0)
+}
+
+func TestConvergence(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []op
+	}{
+		{
+			name: "concurrent moves and resizes",
+			ops: []op{
+				{ts: Timestamp{1, "a"}, positionX: intPtr(10), positionY: intPtr(20)},
+				{ts: Timestamp{1, "b"}, positionX: intPtr(30), positionY: intPtr(40)},
+				{ts: Timestamp{2, "a"}, width: intPtr(100), height: intPtr(50)},
+				{ts: Timestamp{2, "c"}, width: intPtr(200)},
+				{ts: Timestamp{3, "b"}, positionY: intPtr(5), height: intPtr(80)},
+			},
+		},
+		{
+			name: "z-index reorders",
+			ops: []op{
+				{ts: Timestamp{1, "a"}, zIndex: intPtr(1)},
+				{ts: Timestamp{1, "b"}, zIndex: intPtr(2)},
+				{ts: Timestamp{2, "c"}, zIndex: intPtr(0)},
+				{ts: Timestamp{2, "a"}, zIndex: intPtr(5)},
+			},
+		},
+		{
+			name: "data keys edited and deleted",
+			ops: []op{
+				{ts: Timestamp{1, "a"}, data: map[string]interface{}{"content": "hello", "color": "red"}},
+				{ts: Timestamp{2, "b"}, data: map[string]interface{}{"content": "world"}},
+				{ts: Timestamp{2, "a"}, data: map[string]interface{}{"color": nil}},
+				{ts: Timestamp{3, "c"}, data: map[string]interface{}{"color": "blue", "size": 12.0}},
+				{ts: Timestamp{3, "b"}, data: map[string]interface{}{"size": nil}},
+				{ts: Timestamp{1, "c"}, data: map[string]interface{}{"content": nil}},
+			},
+		},
+		{
+			name: "reparents mixed with geometry and data",
+			ops: []op{
+				{ts: Timestamp{1, "a"}, reparent: true, parent: strPtr("section-1"), positionX: intPtr(0), positionY: intPtr(0)},
+				{ts: Timestamp{1, "b"}, reparent: true, parent: nil, positionX: intPtr(300), positionY: intPtr(400)},
+				{ts: Timestamp{2, "c"}, data: map[string]interface{}{"url": "https://example.com"}, width: intPtr(64)},
+				{ts: Timestamp{2, "b"}, zIndex: intPtr(3), data: map[string]interface{}{"url": nil}},
+				{ts: Timestamp{4, "a"}, reparent: true, parent: strPtr("section-2")},
+				{ts: Timestamp{3, "c"}, positionX: intPtr(12), height: intPtr(9)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want *replica
+			var wantOrder []int
+			permutations(len(tt.ops), func(order []int) {
+				r := newReplica()
+				for _, i := range order {
+					r.apply(tt.ops[i])
+				}
+				if want == nil {
+					want = r
+					wantOrder = append([]int(nil), order...)
+					return
+				}
+				if !reflect.DeepEqual(r, want) {
+					t.Fatalf("order %v diverged from %v:\ngot  %s\nwant %s", order, wantOrder, r, want)
+				}
+			})
+		})
+	}
+}
+
+// TestDuplicateDelivery checks that replaying writes a replica has already
+// seen leaves it unchanged.
+func TestDuplicateDelivery(t *testing.T) {
+	ops := []op{
+		{ts: Timestamp{1, "a"}, positionX: intPtr(1), data: map[string]interface{}{"content": "a"}},
+		{ts: Timestamp{2, "b"}, positionX: intPtr(2), data: map[string]interface{}{"content": nil}},
+		{ts: Timestamp{3, "a"}, width: intPtr(3)},
+	}
+	once := newReplica()
+	twice := newReplica()
+	for _, o := range ops {
+		once.apply(o)
+		twice.apply(o)
+	}
+	for i := len(ops) - 1; i >= 0; i-- {
+		twice.apply(ops[i])
+	}
+	if !reflect.DeepEqual(once, twice) {
+		t.Fatalf("replayed writes changed state:\ngot  %s\nwant %s", twice, once)
+	}
+}
+
+func TestDeletedKeyStaysDeleted(t *testing.T) {
+	r := newReplica()
+	r.apply(op{ts: Timestamp{5, "a"}, data: map[string]interface{}{"content": nil}})
+	r.apply(op{ts: Timestamp{4, "b"}, data: map[string]interface{}{"content": "stale"}})
+	if _, ok := r.data["content"]; ok {
+		t.Fatalf("an older write brought back a deleted key: %v", r.data)
+	}
+}
+
+func TestAdmits(t *testing.T) {
+	clocks := Clocks{"width": {Clock: 10, Node: "a"}}
+	tests := []struct {
+		clock uint64
+		want  bool
+	}{
+		{1, true},
+		{11, true},
+		{10 + MaxSkew, true},
+		{11 + MaxSkew, false},
+		{^uint64(0), false},
+	}
+	for _, tt := range tests {
+		if got := clocks.Admits(tt.clock); got != tt.want {
+			t.Errorf("Admits(%d) = %v, want %v", tt.clock, got, tt.want)
+		}
+	}
+}
+
+func (r *replica) String() string {
+	parent := "<nil>"
+	if r.parent != nil {
+		parent = *r.parent
+	}
+	return fmt.Sprintf("{x:%d y:%d w:%d h:%d z:%d parent:%s data:%v}",
+		r.positionX, r.positionY, r.width, r.height, r.zIndex, parent, r.data)
+}
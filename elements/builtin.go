@@ -0,0 +1,426 @@
+package elements
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"website-builder/layout"
+	"website-builder/models"
+)
+
+var (
+	textAlign = []string{"left", "center", "right", "justify"}
+	textTags  = []string{"p", "h1", "h2", "h3", "h4", "h5", "h6", "span"}
+)
+
+func init() {
+	for _, t := range []Type{
+		textType, imageType, buttonType, videoType, formType,
+		sectionType, dividerType, mapType, socialType, componentType,
+	} {
+		MustRegister(t)
+	}
+}
+
+var textType = Spec{
+	TypeName:  string(models.TextElement),
+	TypeLabel: "Text",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "content", Type: String, Label: "Content", Required: true, MaxLength: 20000},
+		{Name: "tag", Type: Enum, Label: "Tag", Options: textTags, Default: "p"},
+		{Name: "font_size", Type: Number, Label: "Font size", Min: limit(1), Max: limit(400)},
+		{Name: "font_weight", Type: Enum, Label: "Font weight", Options: []string{"300", "400", "500", "600", "700", "800"}},
+		{Name: "color", Type: Color, Label: "Color"},
+		{Name: "align", Type: Enum, Label: "Alignment", Options: textAlign, Default: "left"},
+	}},
+	Defaults: map[string]interface{}{"content": "Text"},
+	RenderFunc: func(in RenderInput) Rendered {
+		tag := DataString(in.Data, "tag", "p")
+		if !contains(textTags, tag) {
+			tag = "p"
+		}
+		content := template.HTMLEscapeString(DataString(in.Data, "content", ""))
+		content = strings.ReplaceAll(content, "\n", "<br>")
+
+		style := map[string]string{"margin": "0", "text-align": DataString(in.Data, "align", "left")}
+		if size := DataFloat(in.Data, "font_size", 0); size > 0 {
+			style["font-size"] = Pixels(size)
+		}
+		if weight := DataString(in.Data, "font_weight", ""); weight != "" {
+			style["font-weight"] = weight
+		}
+		if color := DataString(in.Data, "color", ""); color != "" {
+			style["color"] = color
+		}
+		return Rendered{
+			HTML:  template.HTML(fmt.Sprintf("<%s>%s</%s>", tag, content, tag)),
+			Style: style,
+		}
+	},
+}
+
+var imageType = Spec{
+	TypeName:  string(models.ImageElement),
+	TypeLabel: "Image",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "src", Type: URL, Label: "Image URL", Required: true},
+		{Name: "alt", Type: String, Label: "Alt text", MaxLength: 255},
+		{Name: "fit", Type: Enum, Label: "Fit", Options: []string{"cover", "contain", "fill"}, Default: "cover"},
+		{Name: "link", Type: URL, Label: "Link"},
+	}},
+	Defaults: map[string]interface{}{"src": "https://placehold.co/600x400"},
+	RenderFunc: func(in RenderInput) Rendered {
+		img := fmt.Sprintf(`<img src="%s" alt="%s" style="width:100%%;height:100%%;object-fit:%s" loading="lazy">`,
+			attr(DataString(in.Data, "src", "")),
+			attr(DataString(in.Data, "alt", "")),
+			attr(DataString(in.Data, "fit", "cover")))
+		if link := DataString(in.Data, "link", ""); link != "" {
+			img = fmt.Sprintf(`<a href="%s">%s</a>`, attr(link), img)
+		}
+		return Rendered{HTML: template.HTML(img), Style: map[string]string{"overflow": "hidden"}}
+	},
+}
+
+var buttonType = Spec{
+	TypeName:  string(models.ButtonElement),
+	TypeLabel: "Button",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "label", Type: String, Label: "Label", Required: true, MaxLength: 100},
+		{Name: "href", Type: URL, Label: "Link"},
+		{Name: "target", Type: Enum, Label: "Open in", Options: []string{"_self", "_blank"}, Default: "_self"},
+		{Name: "variant", Type: Enum, Label: "Style", Options: []string{"primary", "secondary", "outline", "link"}, Default: "primary"},
+		{Name: "background_color", Type: Color, Label: "Background"},
+		{Name: "color", Type: Color, Label: "Text color"},
+	}},
+	Defaults: map[string]interface{}{"label": "Button"},
+	RenderFunc: func(in RenderInput) Rendered {
+		target := DataString(in.Data, "target", "_self")
+		rel := ""
+		if target == "_blank" {
+			rel = ` rel="noopener noreferrer"`
+		}
+		html := fmt.Sprintf(`<a class="wb-button wb-button-%s" href="%s" target="%s"%s>%s</a>`,
+			attr(DataString(in.Data, "variant", "primary")),
+			attr(DataString(in.Data, "href", "#")),
+			attr(target), rel,
+			template.HTMLEscapeString(DataString(in.Data, "label", "")))
+
+		style := map[string]string{}
+		if background := DataString(in.Data, "background_color", ""); background != "" {
+			style["--wb-button-background"] = background
+		}
+		if color := DataString(in.Data, "color", ""); color != "" {
+			style["--wb-button-color"] = color
+		}
+		return Rendered{HTML: template.HTML(html), Style: style}
+	},
+}
+
+var videoType = Spec{
+	TypeName:  string(models.VideoElement),
+	TypeLabel: "Video",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "src", Type: URL, Label: "Video URL", Required: true},
+		{Name: "provider", Type: Enum, Label: "Provider", Options: []string{"youtube", "vimeo", "file"}, Default: "file"},
+		{Name: "autoplay", Type: Boolean, Label: "Autoplay", Default: false},
+		{Name: "muted", Type: Boolean, Label: "Muted", Default: false},
+		{Name: "controls", Type: Boolean, Label: "Show controls", Default: true},
+		{Name: "loop", Type: Boolean, Label: "Loop", Default: false},
+	}},
+	Defaults: map[string]interface{}{"src": "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "provider": "youtube"},
+	RenderFunc: func(in RenderInput) Rendered {
+		src := DataString(in.Data, "src", "")
+		provider := DataString(in.Data, "provider", "file")
+		if embed, ok := embedURL(provider, src); ok {
+			html := fmt.Sprintf(`<iframe src="%s" style="width:100%%;height:100%%;border:0" allow="autoplay; fullscreen" allowfullscreen></iframe>`, attr(embed))
+			return Rendered{HTML: template.HTML(html)}
+		}
+
+		var flags []string
+		for _, flag := range []string{"autoplay", "muted", "controls", "loop"} {
+			if DataBool(in.Data, flag, flag == "controls") {
+				flags = append(flags, flag)
+			}
+		}
+		html := fmt.Sprintf(`<video src="%s" style="width:100%%;height:100%%" playsinline %s></video>`,
+			attr(src), strings.Join(flags, " "))
+		return Rendered{HTML: template.HTML(html)}
+	},
+}
+
+var formType = Spec{
+	TypeName:  string(models.FormElement),
+	TypeLabel: "Form",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "fields", Type: Array, Label: "Fields", Required: true, Max: limit(50), Items: &Field{
+			Type: Object,
+			Fields: []Field{
+				{Name: "name", Type: String, Label: "Name", Required: true, MaxLength: 100},
+				{Name: "label", Type: String, Label: "Label", MaxLength: 255},
+				{Name: "type", Type: Enum, Label: "Input type", Required: true,
+					Options: []string{"text", "email", "tel", "number", "textarea", "select", "checkbox"}},
+				{Name: "required", Type: Boolean, Label: "Required"},
+				{Name: "options", Type: Array, Label: "Options", Items: &Field{Type: String, MaxLength: 255}},
+			},
+		}},
+		{Name: "submit_label", Type: String, Label: "Submit label", MaxLength: 100, Default: "Submit"},
+		{Name: "action", Type: URL, Label: "Submit to"},
+		{Name: "success_message", Type: String, Label: "Success message", MaxLength: 500},
+	}},
+	Defaults: map[string]interface{}{
+		"fields": []interface{}{
+			map[string]interface{}{"name": "email", "label": "Email", "type": "email", "required": true},
+		},
+	},
+	RenderFunc: func(in RenderInput) Rendered {
+		var b strings.Builder
+		fmt.Fprintf(&b, `<form class="wb-form" method="post" action="%s">`, attr(DataString(in.Data, "action", "")))
+		fields, _ := in.Data["fields"].([]interface{})
+		for _, raw := range fields {
+			field, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			writeFormField(&b, field)
+		}
+		fmt.Fprintf(&b, `<button type="submit">%s</button></form>`,
+			template.HTMLEscapeString(DataString(in.Data, "submit_label", "Submit")))
+		return Rendered{HTML: template.HTML(b.String())}
+	},
+}
+
+// sectionType groups elements. Its layout decides whether children keep
+// their coordinates or flow as a stack or grid, in z-index order.
+var sectionType = Spec{
+	TypeName:  string(models.SectionElement),
+	TypeLabel: "Section",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "background_color", Type: Color, Label: "Background"},
+		{Name: "background_image", Type: URL, Label: "Background image"},
+		{Name: "layout", Type: Enum, Label: "Layout", Options: layout.Modes, Default: string(layout.Absolute)},
+		{Name: "gap", Type: Number, Label: "Gap", Min: limit(0), Max: limit(500)},
+		{Name: "padding", Type: Number, Label: "Padding", Min: limit(0), Max: limit(500)},
+		{Name: "align", Type: Enum, Label: "Align items", Options: layout.Alignments},
+		{Name: "justify", Type: Enum, Label: "Justify content", Options: layout.Justifications},
+		{Name: "columns", Type: Integer, Label: "Columns", Min: limit(1), Max: limit(12)},
+		{Name: "wrap", Type: Boolean, Label: "Wrap"},
+		{Name: "reverse", Type: Boolean, Label: "Reverse order"},
+	}},
+	CheckFunc: func(data map[string]interface{}) []FieldError {
+		flow := SectionFlow(data)
+		var errs []FieldError
+		if !flow.Flows() {
+			for _, key := range []string{"gap", "padding", "align", "justify"} {
+				if _, set := data[key]; set {
+					errs = append(errs, FieldError{Field: key, Message: "only applies to stack and grid layouts"})
+				}
+			}
+		}
+		if _, set := data["columns"]; set && flow.Mode != layout.Grid {
+			errs = append(errs, FieldError{Field: "columns", Message: "only applies to grid layouts"})
+		}
+		if flow.Wrap && flow.Mode != layout.HStack {
+			errs = append(errs, FieldError{Field: "wrap", Message: "only applies to horizontal stacks"})
+		}
+		if flow.Reverse && flow.Mode != layout.VStack && flow.Mode != layout.HStack {
+			errs = append(errs, FieldError{Field: "reverse", Message: "only applies to stacks"})
+		}
+		return errs
+	},
+	RenderFunc: func(in RenderInput) Rendered {
+		style := SectionFlow(in.Data).Container()
+		if color := DataString(in.Data, "background_color", ""); color != "" {
+			style["background-color"] = color
+		}
+		if image := DataString(in.Data, "background_image", ""); image != "" {
+			style["background-image"] = "url(" + CSSString(image) + ")"
+			style["background-size"] = "cover"
+			style["background-position"] = "center"
+		}
+		return Rendered{HTML: in.Children, Style: style}
+	},
+}
+
+// SectionFlow reads the layout of a section from its data. Anything that
+// is not a section lays its children out absolutely.
+func SectionFlow(data map[string]interface{}) layout.Flow {
+	return layout.Flow{
+		Mode:    layout.Mode(DataString(data, "layout", string(layout.Absolute))),
+		Gap:     DataFloat(data, "gap", 0),
+		Padding: DataFloat(data, "padding", 0),
+		Align:   DataString(data, "align", ""),
+		Justify: DataString(data, "justify", ""),
+		Columns: int(DataFloat(data, "columns", 0)),
+		Wrap:    DataBool(data, "wrap", false),
+		Reverse: DataBool(data, "reverse", false),
+	}
+}
+
+// componentType places a project component. Overrides patch the Data of
+// individual component nodes, keyed by node ID; the renderer expands the
+// component into Children.
+var componentType = Spec{
+	TypeName:  string(models.ComponentElement),
+	TypeLabel: "Component",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "component_id", Type: String, Label: "Component", Required: true, MaxLength: 36},
+		{Name: "overrides", Type: Object, Label: "Overrides"},
+	}},
+}
+
+var dividerType = Spec{
+	TypeName:  string(models.DividerElement),
+	TypeLabel: "Divider",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "color", Type: Color, Label: "Color"},
+		{Name: "thickness", Type: Number, Label: "Thickness", Min: limit(1), Max: limit(50), Default: 1},
+		{Name: "style", Type: Enum, Label: "Style", Options: []string{"solid", "dashed", "dotted"}, Default: "solid"},
+	}},
+	RenderFunc: func(in RenderInput) Rendered {
+		border := fmt.Sprintf("%s %s %s",
+			Pixels(DataFloat(in.Data, "thickness", 1)),
+			DataString(in.Data, "style", "solid"),
+			DataString(in.Data, "color", "currentColor"))
+		return Rendered{
+			HTML:  template.HTML(fmt.Sprintf(`<hr style="margin:0;border:0;border-top:%s">`, attr(border))),
+			Style: map[string]string{"display": "flex", "align-items": "center"},
+		}
+	},
+}
+
+var mapType = Spec{
+	TypeName:  string(models.MapElement),
+	TypeLabel: "Map",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "address", Type: String, Label: "Address", Required: true, MaxLength: 500},
+		{Name: "latitude", Type: Number, Label: "Latitude", Min: limit(-90), Max: limit(90)},
+		{Name: "longitude", Type: Number, Label: "Longitude", Min: limit(-180), Max: limit(180)},
+		{Name: "zoom", Type: Integer, Label: "Zoom", Min: limit(1), Max: limit(20), Default: 14},
+	}},
+	Defaults: map[string]interface{}{"address": "Jakarta, Indonesia"},
+	RenderFunc: func(in RenderInput) Rendered {
+		query := DataString(in.Data, "address", "")
+		lat, latOK := in.Data["latitude"].(float64)
+		lng, lngOK := in.Data["longitude"].(float64)
+		if latOK && lngOK {
+			query = fmt.Sprintf("%g,%g", lat, lng)
+		}
+		src := fmt.Sprintf("https://maps.google.com/maps?q=%s&z=%g&output=embed",
+			url.QueryEscape(query), DataFloat(in.Data, "zoom", 14))
+		html := fmt.Sprintf(`<iframe src="%s" title="%s" style="width:100%%;height:100%%;border:0" loading="lazy"></iframe>`,
+			attr(src), attr(DataString(in.Data, "address", "Map")))
+		return Rendered{HTML: template.HTML(html)}
+	},
+}
+
+var socialType = Spec{
+	TypeName:  string(models.SocialElement),
+	TypeLabel: "Social links",
+	DataSchema: Schema{Fields: []Field{
+		{Name: "links", Type: Array, Label: "Links", Required: true, Max: limit(20), Items: &Field{
+			Type: Object,
+			Fields: []Field{
+				{Name: "network", Type: Enum, Label: "Network", Required: true,
+					Options: []string{"facebook", "instagram", "x", "linkedin", "youtube", "tiktok", "github", "email"}},
+				{Name: "url", Type: URL, Label: "URL", Required: true},
+			},
+		}},
+		{Name: "size", Type: Integer, Label: "Icon size", Min: limit(8), Max: limit(128), Default: 24},
+		{Name: "color", Type: Color, Label: "Icon color"},
+	}},
+	Defaults: map[string]interface{}{
+		"links": []interface{}{
+			map[string]interface{}{"network": "instagram", "url": "https://instagram.com"},
+		},
+	},
+	RenderFunc: func(in RenderInput) Rendered {
+		var b strings.Builder
+		b.WriteString(`<ul class="wb-social">`)
+		links, _ := in.Data["links"].([]interface{})
+		for _, raw := range links {
+			link, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			network := DataString(link, "network", "")
+			fmt.Fprintf(&b, `<li><a class="wb-social-%s" href="%s" target="_blank" rel="noopener noreferrer">%s</a></li>`,
+				attr(network), attr(DataString(link, "url", "")), template.HTMLEscapeString(network))
+		}
+		b.WriteString(`</ul>`)
+
+		style := map[string]string{"--wb-social-size": Pixels(DataFloat(in.Data, "size", 24))}
+		if color := DataString(in.Data, "color", ""); color != "" {
+			style["color"] = color
+		}
+		return Rendered{HTML: template.HTML(b.String()), Style: style}
+	},
+}
+
+func contains(options []string, value string) bool {
+	for _, option := range options {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+// attr escapes s for use inside a double-quoted HTML attribute.
+func attr(s string) string {
+	return template.HTMLEscapeString(s)
+}
+
+func writeFormField(b *strings.Builder, field map[string]interface{}) {
+	name := attr(DataString(field, "name", ""))
+	label := template.HTMLEscapeString(DataString(field, "label", DataString(field, "name", "")))
+	required := ""
+	if DataBool(field, "required", false) {
+		required = " required"
+	}
+
+	switch inputType := DataString(field, "type", "text"); inputType {
+	case "textarea":
+		fmt.Fprintf(b, `<label>%s<textarea name="%s"%s></textarea></label>`, label, name, required)
+	case "select":
+		fmt.Fprintf(b, `<label>%s<select name="%s"%s>`, label, name, required)
+		options, _ := field["options"].([]interface{})
+		for _, option := range options {
+			if s, ok := option.(string); ok {
+				fmt.Fprintf(b, `<option>%s</option>`, template.HTMLEscapeString(s))
+			}
+		}
+		b.WriteString(`</select></label>`)
+	case "checkbox":
+		fmt.Fprintf(b, `<label><input type="checkbox" name="%s"%s>%s</label>`, name, required, label)
+	default:
+		fmt.Fprintf(b, `<label>%s<input type="%s" name="%s"%s></label>`, label, attr(inputType), name, required)
+	}
+}
+
+// embedURL converts a YouTube or Vimeo page URL into its player URL.
+func embedURL(provider string, src string) (string, bool) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", false
+	}
+	switch provider {
+	case "youtube":
+		id := u.Query().Get("v")
+		if u.Host == "youtu.be" || strings.HasPrefix(u.Path, "/embed/") {
+			id = u.Path[strings.LastIndex(u.Path, "/")+1:]
+		}
+		if id == "" {
+			return "", false
+		}
+		return "https://www.youtube.com/embed/" + url.PathEscape(id), true
+	case "vimeo":
+		id := strings.Trim(u.Path, "/")
+		if id == "" || strings.Contains(id, "/") && !strings.HasPrefix(id, "video/") {
+			return "", false
+		}
+		return "https://player.vimeo.com/video/" + url.PathEscape(strings.TrimPrefix(id, "video/")), true
+	}
+	return "", false
+}
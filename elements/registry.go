@@ -0,0 +1,110 @@
+package elements
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	mu    sync.RWMutex
+	types = map[string]Type{}
+)
+
+// Register makes an element type available for validation, rendering and
+// the palette. Names must be unique.
+func Register(t Type) error {
+	name := t.Name()
+	if name == "" || len(name) > 50 {
+		return errors.New("element type name must be 1 to 50 characters")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := types[name]; exists {
+		return fmt.Errorf("element type %q is already registered", name)
+	}
+	types[name] = t
+	return nil
+}
+
+// MustRegister is like Register but panics on error, for use at startup.
+func MustRegister(t Type) {
+	if err := Register(t); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the registered type with the given name.
+func Lookup(name string) (Type, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	t, ok := types[name]
+	return t, ok
+}
+
+// All returns every registered type ordered by name.
+func All() []Type {
+	mu.RLock()
+	defer mu.RUnlock()
+	all := make([]Type, 0, len(types))
+	for _, t := range types {
+		all = append(all, t)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name() < all[j].Name() })
+	return all
+}
+
+// PaletteEntry describes a type to the editor.
+type PaletteEntry struct {
+	Type        string                 `json:"type"`
+	Label       string                 `json:"label"`
+	Schema      Schema                 `json:"schema"`
+	DefaultData map[string]interface{} `json:"default_data"`
+}
+
+// Palette describes every registered type.
+func Palette() []PaletteEntry {
+	all := All()
+	entries := make([]PaletteEntry, 0, len(all))
+	for _, t := range all {
+		entries = append(entries, PaletteEntry{
+			Type:        t.Name(),
+			Label:       t.Label(),
+			Schema:      t.Schema(),
+			DefaultData: t.DefaultData(),
+		})
+	}
+	return entries
+}
+
+// Validate checks data against the schema of the named type, and its own
+// rules if it is a Checker.
+func Validate(name string, data map[string]interface{}) error {
+	t, ok := Lookup(name)
+	if !ok {
+		return &ValidationError{Errors: []FieldError{{
+			Field:   "type",
+			Message: fmt.Sprintf("unknown element type %q", name),
+		}}}
+	}
+	err := t.Schema().Validate(data)
+	checker, ok := t.(Checker)
+	if !ok {
+		return err
+	}
+
+	var errs []FieldError
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		errs = invalid.Errors
+	} else if err != nil {
+		return err
+	}
+	errs = append(errs, checker.Check(data)...)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
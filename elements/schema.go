@@ -0,0 +1,203 @@
+// Package elements describes the data each element type accepts and
+// validates Element.Data against it.
+package elements
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// FieldType is the kind of value a schema field holds.
+type FieldType string
+
+const (
+	String  FieldType = "string"
+	Number  FieldType = "number"
+	Integer FieldType = "integer"
+	Boolean FieldType = "boolean"
+	URL     FieldType = "url"
+	Color   FieldType = "color"
+	Enum    FieldType = "enum"
+	Array   FieldType = "array"
+	Object  FieldType = "object"
+)
+
+// Field describes one key of an element's data. Items describes the
+// entries of an Array field and Fields the keys of an Object field.
+type Field struct {
+	Name      string      `json:"name"`
+	Type      FieldType   `json:"type"`
+	Label     string      `json:"label,omitempty"`
+	Required  bool        `json:"required,omitempty"`
+	Options   []string    `json:"options,omitempty"`
+	Min       *float64    `json:"min,omitempty"`
+	Max       *float64    `json:"max,omitempty"`
+	MaxLength int         `json:"max_length,omitempty"`
+	Default   interface{} `json:"default,omitempty"`
+	Items     *Field      `json:"items,omitempty"`
+	Fields    []Field     `json:"fields,omitempty"`
+}
+
+// Schema lists the fields an element type understands. Keys not listed
+// are left alone so clients can keep their own metadata in Data.
+type Schema struct {
+	Fields []Field `json:"fields"`
+}
+
+// FieldError is a validation failure for a single field, addressed by its
+// path within Data, e.g. "links[1].url".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field that failed validation.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+	}
+	return "invalid element data: " + strings.Join(messages, "; ")
+}
+
+// Validate checks data against the schema, returning a *ValidationError
+// listing every offending field.
+func (s Schema) Validate(data map[string]interface{}) error {
+	var errs []FieldError
+	validateFields(s.Fields, data, "", &errs)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func validateFields(fields []Field, data map[string]interface{}, prefix string, errs *[]FieldError) {
+	for _, field := range fields {
+		path := prefix + field.Name
+		value, ok := data[field.Name]
+		if !ok || value == nil || value == "" {
+			if field.Required {
+				*errs = append(*errs, FieldError{Field: path, Message: "is required"})
+			}
+			continue
+		}
+		validateValue(field, value, path, errs)
+	}
+}
+
+var (
+	hexColor  = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+	funcColor = regexp.MustCompile(`^(rgb|rgba|hsl|hsla)\([0-9.,%\s/]+\)$`)
+)
+
+func validateValue(field Field, value interface{}, path string, errs *[]FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch field.Type {
+	case String, URL, Color, Enum:
+		s, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+		if field.MaxLength > 0 && len([]rune(s)) > field.MaxLength {
+			fail("must be at most %d characters", field.MaxLength)
+		}
+		switch field.Type {
+		case URL:
+			if !validURL(s) {
+				fail("must be an http(s), mailto: or tel: URL, or a path starting with / or #")
+			}
+		case Color:
+			if !hexColor.MatchString(s) && !funcColor.MatchString(s) && s != "transparent" {
+				fail("must be a hex, rgb() or hsl() color")
+			}
+		case Enum:
+			if !contains(field.Options, s) {
+				fail("must be one of %s", strings.Join(field.Options, ", "))
+			}
+		}
+	case Number, Integer:
+		n, ok := value.(float64)
+		if !ok {
+			fail("must be a number")
+			return
+		}
+		if field.Type == Integer && n != math.Trunc(n) {
+			fail("must be a whole number")
+		}
+		if field.Min != nil && n < *field.Min {
+			fail("must be at least %v", *field.Min)
+		}
+		if field.Max != nil && n > *field.Max {
+			fail("must be at most %v", *field.Max)
+		}
+	case Boolean:
+		if _, ok := value.(bool); !ok {
+			fail("must be true or false")
+		}
+	case Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("must be a list")
+			return
+		}
+		if field.Required && len(items) == 0 {
+			fail("must not be empty")
+		}
+		if field.Max != nil && float64(len(items)) > *field.Max {
+			fail("must have at most %v entries", *field.Max)
+		}
+		if field.Items != nil {
+			for i, item := range items {
+				validateValue(*field.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case Object:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			return
+		}
+		validateFields(field.Fields, obj, path+".", errs)
+	}
+}
+
+func validURL(s string) bool {
+	// "//host" and "/\host" are protocol-relative in browsers and would
+	// leave the site. Browsers also drop tabs and newlines, so "/\t/host"
+	// is one of them too.
+	if strings.ContainsAny(s, "\t\n\r") {
+		return false
+	}
+	if strings.HasPrefix(s, "/") {
+		return !strings.HasPrefix(s[1:], "/") && !strings.HasPrefix(s[1:], "\\")
+	}
+	if strings.HasPrefix(s, "#") {
+		return true
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto", "tel":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+func limit(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,136 @@
+package elements
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// Type is an element type that can be placed on a page. Built-in types are
+// registered by this package; applications add their own with Register
+// before the server starts.
+type Type interface {
+	// Name is the value stored in element.type, e.g. "button".
+	Name() string
+	// Label is shown in the editor's palette.
+	Label() string
+	// Schema describes the element's Data.
+	Schema() Schema
+	// DefaultData seeds the Data of newly created elements.
+	DefaultData() map[string]interface{}
+	// Render produces the element's markup and styles.
+	Render(input RenderInput) Rendered
+}
+
+// Checker is implemented by types whose data has rules spanning several
+// fields. Check runs after the schema has been validated.
+type Checker interface {
+	Check(data map[string]interface{}) []FieldError
+}
+
+// RenderInput is what a Type sees of an element when rendering it.
+type RenderInput struct {
+	ID   string
+	Data map[string]interface{}
+	// Children is the already rendered markup of nested elements.
+	Children template.HTML
+}
+
+// Rendered is a rendered element. Style holds CSS declarations applied to
+// the element's box alongside its position and size.
+type Rendered struct {
+	HTML  template.HTML
+	Style map[string]string
+}
+
+// Spec implements Type from plain values, which is enough for most types.
+type Spec struct {
+	TypeName   string
+	TypeLabel  string
+	DataSchema Schema
+	Defaults   map[string]interface{}
+	RenderFunc func(input RenderInput) Rendered
+	CheckFunc  func(data map[string]interface{}) []FieldError
+}
+
+func (s Spec) Name() string   { return s.TypeName }
+func (s Spec) Label() string  { return s.TypeLabel }
+func (s Spec) Schema() Schema { return s.DataSchema }
+
+// DefaultData combines the schema's field defaults with Defaults, which
+// take precedence.
+func (s Spec) DefaultData() map[string]interface{} {
+	data := make(map[string]interface{}, len(s.Defaults))
+	for _, field := range s.DataSchema.Fields {
+		if field.Default != nil {
+			data[field.Name] = field.Default
+		}
+	}
+	for key, value := range s.Defaults {
+		data[key] = value
+	}
+	return data
+}
+
+func (s Spec) Check(data map[string]interface{}) []FieldError {
+	if s.CheckFunc == nil {
+		return nil
+	}
+	return s.CheckFunc(data)
+}
+
+func (s Spec) Render(input RenderInput) Rendered {
+	if s.RenderFunc == nil {
+		return Rendered{HTML: input.Children}
+	}
+	return s.RenderFunc(input)
+}
+
+// DataString returns data[key] if it is a non-empty string, else fallback.
+func DataString(data map[string]interface{}, key string, fallback string) string {
+	if s, ok := data[key].(string); ok && s != "" {
+		return s
+	}
+	return fallback
+}
+
+// DataFloat returns data[key] if it is a number, else fallback.
+func DataFloat(data map[string]interface{}, key string, fallback float64) float64 {
+	if n, ok := data[key].(float64); ok {
+		return n
+	}
+	return fallback
+}
+
+// DataBool returns data[key] if it is a boolean, else fallback.
+func DataBool(data map[string]interface{}, key string, fallback bool) bool {
+	if b, ok := data[key].(bool); ok {
+		return b
+	}
+	return fallback
+}
+
+// Pixels formats a length in CSS pixels.
+func Pixels(n float64) string {
+	return fmt.Sprintf("%gpx", n)
+}
+
+// CSSString quotes s as a CSS string. ASCII other than letters, digits and
+// characters common in URLs is hex-escaped, so s cannot end the string, the
+// declaration or the style element.
+func CSSString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r >= 0x80:
+			b.WriteRune(r)
+		case strings.ContainsRune("-_.~:/?#[]@!$&*+,;=%", r):
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "\\%x ", r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,241 @@
+// Package layout resolves where elements sit at each breakpoint and turns
+// that into CSS.
+package layout
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"website-builder/models"
+)
+
+const (
+	Desktop = "desktop"
+	Tablet  = "tablet"
+	Mobile  = "mobile"
+)
+
+// Builtin are the breakpoints every project has. Desktop is the base
+// layout held in an element's own position and size.
+var Builtin = models.Breakpoints{
+	{Name: Desktop},
+	{Name: Tablet, MaxWidth: 1024},
+	{Name: Mobile, MaxWidth: 767},
+}
+
+// maxViewport bounds the width of custom breakpoints.
+const maxViewport = 10000
+
+var breakpointName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,29}$`)
+
+// Validate checks a project's custom breakpoints: names must be short
+// slugs and, like widths, distinct from each other and the built-ins.
+func Validate(custom models.Breakpoints) error {
+	names := make(map[string]bool, len(Builtin)+len(custom))
+	widths := make(map[int]bool, len(Builtin)+len(custom))
+	for _, bp := range Builtin {
+		names[bp.Name] = true
+		widths[bp.MaxWidth] = true
+	}
+
+	for _, bp := range custom {
+		if !breakpointName.MatchString(bp.Name) {
+			return fmt.Errorf("breakpoint name %q must start with a letter and use only a-z, 0-9, - and _", bp.Name)
+		}
+		if names[bp.Name] {
+			return fmt.Errorf("breakpoint %q is already defined", bp.Name)
+		}
+		if bp.MaxWidth < 1 || bp.MaxWidth > maxViewport {
+			return fmt.Errorf("breakpoint %q must have a max_width between 1 and %d", bp.Name, maxViewport)
+		}
+		if widths[bp.MaxWidth] {
+			return fmt.Errorf("another breakpoint already ends at %dpx", bp.MaxWidth)
+		}
+		names[bp.Name] = true
+		widths[bp.MaxWidth] = true
+	}
+	return nil
+}
+
+// Resolve returns the built-in breakpoints together with a project's
+// custom ones, widest first, so desktop always leads.
+func Resolve(custom models.Breakpoints) models.Breakpoints {
+	all := make(models.Breakpoints, 0, len(Builtin)+len(custom))
+	all = append(all, Builtin...)
+	all = append(all, custom...)
+	sort.SliceStable(all, func(i, j int) bool { return wider(all[i], all[j]) })
+	return all
+}
+
+func wider(a models.Breakpoint, b models.Breakpoint) bool {
+	if a.MaxWidth == 0 || b.MaxWidth == 0 {
+		return a.MaxWidth == 0 && b.MaxWidth != 0
+	}
+	return a.MaxWidth > b.MaxWidth
+}
+
+// Has reports whether breakpoints includes one called name.
+func Has(breakpoints models.Breakpoints, name string) bool {
+	for _, bp := range breakpoints {
+		if bp.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Box is an element's resolved geometry at one breakpoint.
+type Box struct {
+	PositionX int  `json:"position_x"`
+	PositionY int  `json:"position_y"`
+	Width     int  `json:"width"`
+	Height    int  `json:"height"`
+	ZIndex    int  `json:"z_index"`
+	Hidden    bool `json:"hidden"`
+}
+
+// Base is the desktop box of an element, before any override.
+func Base(element *models.Element) Box {
+	return Box{
+		PositionX: element.PositionX,
+		PositionY: element.PositionY,
+		Width:     element.Width,
+		Height:    element.Height,
+		ZIndex:    element.ZIndex,
+	}
+}
+
+// Apply returns the box with the fields set in override replaced.
+func (b Box) Apply(override models.LayoutOverride) Box {
+	if override.PositionX != nil {
+		b.PositionX = *override.PositionX
+	}
+	if override.PositionY != nil {
+		b.PositionY = *override.PositionY
+	}
+	if override.Width != nil {
+		b.Width = *override.Width
+	}
+	if override.Height != nil {
+		b.Height = *override.Height
+	}
+	if override.ZIndex != nil {
+		b.ZIndex = *override.ZIndex
+	}
+	if override.Hidden != nil {
+		b.Hidden = *override.Hidden
+	}
+	return b
+}
+
+// Cascade resolves an element's box at every breakpoint. Breakpoints must
+// be ordered widest first, as Resolve returns them; each one starts from
+// the box of the breakpoint above it. Overrides for breakpoints that are
+// not listed are ignored.
+func Cascade(breakpoints models.Breakpoints, base Box, overrides models.Layouts) map[string]Box {
+	boxes := make(map[string]Box, len(breakpoints))
+	box := base
+	for _, bp := range breakpoints {
+		box = box.Apply(overrides[bp.Name])
+		boxes[bp.Name] = box
+	}
+	return boxes
+}
+
+// MediaQuery returns the media query matching viewports up to the
+// breakpoint's width, or "" for a breakpoint that applies at any width.
+func MediaQuery(bp models.Breakpoint) string {
+	if bp.MaxWidth == 0 {
+		return ""
+	}
+	return fmt.Sprintf("@media (max-width: %dpx)", bp.MaxWidth)
+}
+
+// rangeQuery matches only the viewports where breakpoints[i] is the
+// narrowest breakpoint that applies.
+func rangeQuery(breakpoints models.Breakpoints, i int) string {
+	var conditions []string
+	if i+1 < len(breakpoints) {
+		conditions = append(conditions, fmt.Sprintf("(min-width: %dpx)", breakpoints[i+1].MaxWidth+1))
+	}
+	if breakpoints[i].MaxWidth > 0 {
+		conditions = append(conditions, fmt.Sprintf("(max-width: %dpx)", breakpoints[i].MaxWidth))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "@media " + strings.Join(conditions, " and ")
+}
+
+// CSS returns the responsive rules for selector, an element placed by
+// parent. Geometry cascades: the widest box is a plain rule and narrower
+// breakpoints only restate what changed inside max-width queries. Hiding
+// is scoped to the exact width range of each breakpoint so the element's
+// own display is never touched where it is visible.
+func CSS(selector string, parent Flow, breakpoints models.Breakpoints, boxes map[string]Box) string {
+	var b strings.Builder
+	var previous map[string]string
+	for _, bp := range breakpoints {
+		box, ok := boxes[bp.Name]
+		if !ok {
+			continue
+		}
+		declarations := parent.Child(box)
+		changed := make(map[string]string, len(declarations))
+		for property, value := range declarations {
+			if previous == nil || previous[property] != value {
+				changed[property] = value
+			}
+		}
+		previous = declarations
+		writeRule(&b, MediaQuery(bp), selector, changed)
+	}
+
+	for i, bp := range breakpoints {
+		if box, ok := boxes[bp.Name]; ok && box.Hidden {
+			writeRule(&b, rangeQuery(breakpoints, i), selector, map[string]string{"display": "none"})
+		}
+	}
+	return b.String()
+}
+
+// Rule formats declarations as a CSS rule, wrapped in query unless it is
+// empty. Properties are sorted so output is stable.
+func Rule(query string, selector string, declarations map[string]string) string {
+	var b strings.Builder
+	writeRule(&b, query, selector, declarations)
+	return b.String()
+}
+
+func writeRule(b *strings.Builder, query string, selector string, declarations map[string]string) {
+	if len(declarations) == 0 {
+		return
+	}
+	properties := make([]string, 0, len(declarations))
+	for property := range declarations {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	if query != "" {
+		b.WriteString(query)
+		b.WriteString("{")
+	}
+	b.WriteString(selector)
+	b.WriteString("{")
+	for i, property := range properties {
+		if i > 0 {
+			b.WriteString(";")
+		}
+		b.WriteString(property)
+		b.WriteString(":")
+		b.WriteString(declarations[property])
+	}
+	b.WriteString("}")
+	if query != "" {
+		b.WriteString("}")
+	}
+	b.WriteString("\n")
+}
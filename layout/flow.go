@@ -0,0 +1,143 @@
+package layout
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Mode is how a section places its children.
+type Mode string
+
+const (
+	// Absolute places children at their own coordinates.
+	Absolute Mode = "absolute"
+	// VStack and HStack lay children out in a column or a row.
+	VStack Mode = "vstack"
+	HStack Mode = "hstack"
+	// Grid lays children out in rows of equal-width columns.
+	Grid Mode = "grid"
+)
+
+var (
+	Modes          = []string{string(Absolute), string(VStack), string(HStack), string(Grid)}
+	Alignments     = []string{"start", "center", "end", "stretch"}
+	Justifications = []string{"start", "center", "end", "space-between", "space-around"}
+)
+
+// defaultColumns is used by grids that do not say how many columns they
+// have.
+const defaultColumns = 2
+
+// Flow is a section's layout. Children of stacks and grids are placed in
+// z-index order and their coordinates are ignored; only their size is
+// kept.
+type Flow struct {
+	Mode    Mode
+	Gap     float64
+	Padding float64
+	// Align places children on the cross axis, Justify along the main
+	// axis.
+	Align   string
+	Justify string
+	Columns int
+	Wrap    bool
+	Reverse bool
+}
+
+// Flows reports whether children are laid out by rules rather than their
+// coordinates.
+func (f Flow) Flows() bool {
+	return f.Mode == VStack || f.Mode == HStack || f.Mode == Grid
+}
+
+// Container is the CSS of the section itself.
+func (f Flow) Container() map[string]string {
+	style := map[string]string{}
+	switch f.Mode {
+	case VStack, HStack:
+		direction := "column"
+		if f.Mode == HStack {
+			direction = "row"
+		}
+		if f.Reverse {
+			direction += "-reverse"
+		}
+		style["display"] = "flex"
+		style["flex-direction"] = direction
+		if f.Wrap {
+			style["flex-wrap"] = "wrap"
+		}
+	case Grid:
+		columns := f.Columns
+		if columns < 1 {
+			columns = defaultColumns
+		}
+		style["display"] = "grid"
+		style["grid-template-columns"] = fmt.Sprintf("repeat(%d, minmax(0, 1fr))", columns)
+	default:
+		return style
+	}
+
+	style["box-sizing"] = "border-box"
+	if f.Gap > 0 {
+		style["gap"] = pixels(f.Gap)
+	}
+	if f.Padding > 0 {
+		style["padding"] = pixels(f.Padding)
+	}
+	if f.Align != "" {
+		style["align-items"] = flexValue(f.Align)
+	}
+	if f.Justify != "" {
+		style["justify-content"] = flexValue(f.Justify)
+	}
+	return style
+}
+
+// Child is the CSS placing a child of the section with the given box.
+// Absolute children keep their coordinates; flowing children keep only
+// their size, and not even that along an axis they are stretched on.
+func (f Flow) Child(b Box) map[string]string {
+	if !f.Flows() {
+		return map[string]string{
+			"position": "absolute",
+			"left":     pixels(float64(b.PositionX)),
+			"top":      pixels(float64(b.PositionY)),
+			"width":    pixels(float64(b.Width)),
+			"height":   pixels(float64(b.Height)),
+			"z-index":  strconv.Itoa(b.ZIndex),
+		}
+	}
+
+	style := map[string]string{
+		"position": "relative",
+		"width":    pixels(float64(b.Width)),
+		"height":   pixels(float64(b.Height)),
+	}
+	switch {
+	case f.Mode == Grid:
+		delete(style, "width")
+	case f.Mode == VStack && f.Align == "stretch":
+		delete(style, "width")
+	case f.Mode == HStack && f.Align == "stretch":
+		delete(style, "height")
+	}
+	if f.Mode != Grid {
+		style["flex"] = "none"
+	}
+	return style
+}
+
+func flexValue(value string) string {
+	switch value {
+	case "start":
+		return "flex-start"
+	case "end":
+		return "flex-end"
+	}
+	return value
+}
+
+func pixels(n float64) string {
+	return fmt.Sprintf("%gpx", n)
+}
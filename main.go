@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"website-builder/config"
+	"website-builder/mailer"
 	"website-builder/routes"
 	"website-builder/websocket"
 
@@ -36,23 +44,52 @@ func main() {
 	}))
 
 	// Initialize WebSocket hub
-	hub := websocket.NewHub()
+	hub := websocket.NewHub(getWebSocketConfigFromEnv())
+	broker := getBrokerFromEnv()
+	defer broker.Close()
+	if err := hub.UseBroker(broker); err != nil {
+		log.Fatalf("Failed to subscribe to WebSocket broker: %v", err)
+	}
 	go hub.Run()
 
-	// Pass hub to routes
-	routes.SetupRoutes(r, config.DB, hub)
+	// Pass hub and mailer to routes
+	routes.SetupRoutes(r, config.DB, hub, mailer.FromEnv(), allowedOrigins)
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+
 	// Run server
-	log.Printf("Server running on port %s", port)
-	log.Printf("Allowed origins: %v", allowedOrigins)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		log.Printf("Server running on port %s", port)
+		log.Printf("Allowed origins: %v", allowedOrigins)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Wait for interrupt signal to gracefully shut down the server
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
 	}
+	if err := hub.Stop(shutdownCtx); err != nil {
+		log.Printf("WebSocket hub shutdown error: %v", err)
+	}
+	log.Println("Server stopped")
 }
 
 func getOriginsFromEnv() []string {
@@ -79,3 +116,68 @@ func getOriginsFromEnv() []string {
 
 	return append(defaultOrigins, origins...)
 }
+
+func getWebSocketConfigFromEnv() websocket.Config {
+	cfg := websocket.DefaultConfig()
+
+	if v := os.Getenv("WS_MAX_MESSAGE_SIZE"); v != "" {
+		if size, err := strconv.ParseInt(v, 10, 64); err == nil && size > 0 {
+			cfg.MaxMessageSize = size
+		} else {
+			log.Printf("Ignoring invalid WS_MAX_MESSAGE_SIZE: %s", v)
+		}
+	}
+	if v := os.Getenv("WS_PONG_WAIT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.PongWait = d
+			cfg.PingPeriod = d * 9 / 10
+		} else {
+			log.Printf("Ignoring invalid WS_PONG_WAIT: %s", v)
+		}
+	}
+	if v := os.Getenv("WS_WRITE_WAIT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.WriteWait = d
+		} else {
+			log.Printf("Ignoring invalid WS_WRITE_WAIT: %s", v)
+		}
+	}
+
+	if v := os.Getenv("WS_REPLAY_BUFFER"); v != "" {
+		if size, err := strconv.Atoi(v); err == nil && size >= 0 {
+			cfg.ReplayBuffer = size
+		} else {
+			log.Printf("Ignoring invalid WS_REPLAY_BUFFER: %s", v)
+		}
+	}
+	if v := os.Getenv("WS_REPLAY_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			cfg.ReplayTTL = d
+		} else {
+			log.Printf("Ignoring invalid WS_REPLAY_TTL: %s", v)
+		}
+	}
+
+	return cfg
+}
+
+// getBrokerFromEnv fans WebSocket events out through Redis when REDIS_URL is
+// set, so replicas behind a load balancer share rooms.
+func getBrokerFromEnv() websocket.Broker {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		return websocket.NewMemoryBroker()
+	}
+
+	channel := os.Getenv("WS_BROKER_CHANNEL")
+	if channel == "" {
+		channel = "website-builder:ws"
+	}
+
+	broker, err := websocket.NewRedisBroker(redisURL, channel)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis broker: %v", err)
+	}
+	log.Printf("WebSocket events fan out through Redis channel %s", channel)
+	return broker
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"website-builder/policy"
+)
+
+// Locator extracts the resource a request acts on. ok is false when the
+// request does not name one.
+type Locator func(c *gin.Context) (res policy.Resource, ok bool)
+
+// Param locates the resource from a path parameter.
+func Param(name string, kind policy.Kind) Locator {
+	return func(c *gin.Context) (policy.Resource, bool) {
+		id := c.Param(name)
+		return policy.Resource{Kind: kind, ID: id}, id != ""
+	}
+}
+
+// Query locates the resource from a query parameter.
+func Query(name string, kind policy.Kind) Locator {
+	return func(c *gin.Context) (policy.Resource, bool) {
+		id := c.Query(name)
+		return policy.Resource{Kind: kind, ID: id}, id != ""
+	}
+}
+
+// Body locates the resource from a top-level string field of the JSON body.
+// The body is restored so the handler can bind it again.
+func Body(field string, kind policy.Kind) Locator {
+	return func(c *gin.Context) (policy.Resource, bool) {
+		res := policy.Resource{Kind: kind}
+		if c.Request.Body == nil {
+			return res, false
+		}
+		data, err := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		if err != nil {
+			return res, false
+		}
+
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data, &fields) != nil || json.Unmarshal(fields[field], &res.ID) != nil {
+			return res, false
+		}
+		return res, res.ID != ""
+	}
+}
+
+// Authorize only lets the request through if the authenticated user may
+// perform action on the located resource. The user's role in the owning
+// team is stored under policy.RoleKey for finer checks in the handler.
+func Authorize(p *policy.Policy, action policy.Action, locate Locator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := locate(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": string(res.Kind) + " is required"})
+			return
+		}
+
+		allowed, role, err := p.Can(c.GetString("userID"), action, res)
+		if errors.Is(err, policy.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			return
+		}
+
+		c.Set(policy.RoleKey, role)
+		c.Next()
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"website-builder/utils"
+)
+
+// BearerSubprotocolPrefix marks a WebSocket subprotocol entry carrying a
+// JWT, e.g. "bearer.<token>", for browsers that cannot set headers.
+const BearerSubprotocolPrefix = "bearer."
+
+// TicketRedeemer exchanges a single-use ticket for the user it was issued to.
+type TicketRedeemer func(ticket string) (userID string, ok bool)
+
+// WebSocketAuthMiddleware authenticates a WebSocket handshake from the
+// Authorization header, a "bearer.<token>" subprotocol entry or a ?ticket=
+// query parameter obtained from POST /api/ws/ticket.
+func WebSocketAuthMiddleware(redeem TicketRedeemer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ticket := c.Query("ticket"); ticket != "" {
+			userID, ok := redeem(ticket)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+				return
+			}
+			c.Set("userID", userID)
+			c.Next()
+			return
+		}
+
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = subprotocolToken(c.Request)
+		}
+		if tokenString == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token or ticket required"})
+			return
+		}
+
+		claims, err := utils.ValidateJWT(tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		c.Set("userID", claims.UserID)
+		c.Next()
+	}
+}
+
+func subprotocolToken(r *http.Request) string {
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocol = strings.TrimSpace(protocol)
+			if strings.HasPrefix(protocol, BearerSubprotocolPrefix) {
+				return strings.TrimPrefix(protocol, BearerSubprotocolPrefix)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Component is a reusable element subtree defined once per project and
+// placed on pages through elements of type "component".
+type Component struct {
+	gorm.Model
+	ID        string         `gorm:"primaryKey;type:char(36)"`
+	ProjectID string         `gorm:"not null;type:char(36);index"`
+	Name      string         `gorm:"not null;size:100"`
+	Width     int            `gorm:"not null"`
+	Height    int            `gorm:"not null"`
+	Elements  ComponentNodes `gorm:"type:json;not null"`
+	Version   int            `gorm:"not null;default:1"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Project   Project `gorm:"foreignKey:ProjectID"`
+}
+
+func (Component) TableName() string {
+	return "component"
+}
+
+// ComponentNode is one element of a component's subtree. Root nodes are
+// positioned relative to the top-left corner of each instance.
+type ComponentNode struct {
+	ID              string      `json:"id"`
+	Type            ElementType `json:"type"`
+	Data            JSON        `json:"data"`
+	PositionX       int         `json:"position_x"`
+	PositionY       int         `json:"position_y"`
+	Width           int         `json:"width"`
+	Height          int         `json:"height"`
+	ZIndex          int         `json:"z_index"`
+	ParentElementID *string     `json:"parent_element_id"`
+}
+
+type ComponentNodes []ComponentNode
+
+// ApplyOverride returns a copy of a node's data patched with an instance
+// override. A nil value in the patch removes the key.
+func ApplyOverride(data JSON, patch map[string]interface{}) JSON {
+	result := make(JSON, len(data)+len(patch))
+	for key, value := range data {
+		result[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+func (n *ComponentNodes) Scan(value interface{}) error {
+	if value == nil {
+		*n = nil
+		return nil
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(b, n)
+}
+
+func (n ComponentNodes) Value() (driver.Value, error) {
+	if n == nil {
+		return json.Marshal([]ComponentNode{})
+	}
+	return json.Marshal(n)
+}
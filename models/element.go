@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
+	"website-builder/crdt"
 	"gorm.io/gorm"
 )
 
+// ElementType names an element type registered with the elements package.
+// The constants are the built-in types.
 type ElementType string
 
 const (
@@ -20,13 +23,15 @@ const (
 	DividerElement ElementType = "divider"
 	MapElement     ElementType = "map"
 	SocialElement  ElementType = "social"
+	// ComponentElement is an instance of a Component
+	ComponentElement ElementType = "component"
 )
 
 type Element struct {
 	gorm.Model
 	ID              string      `gorm:"primaryKey;type:char(36)"`
 	PageID          string      `gorm:"not null;type:char(36)"`
-	Type            ElementType `gorm:"type:enum('text','image','button','video','form','section','divider','map','social');not null"`
+	Type            ElementType `gorm:"type:varchar(50);not null;index"`
 	Data            JSON        `gorm:"type:json;not null"`
 	PositionX       int         `gorm:"not null"`
 	PositionY       int         `gorm:"not null"`
@@ -34,6 +39,8 @@ type Element struct {
 	Height          int         `gorm:"not null"`
 	ZIndex          int         `gorm:"default:0"`
 	ParentElementID *string     `gorm:"type:char(36)"`
+	Layouts         Layouts     `gorm:"type:json"`
+	Clocks          crdt.Clocks `gorm:"type:json"`
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 	Page            Page       `gorm:"foreignKey:PageID"`
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// ElementLock is a soft lock held by a WebSocket connection while a user
+// has an element open in the inspector.
+type ElementLock struct {
+	ElementID string    `gorm:"primaryKey;type:char(36)"`
+	ProjectID string    `gorm:"not null;type:char(36);index"`
+	UserID    string    `gorm:"not null;type:char(36)"`
+	SocketID  string    `gorm:"not null;size:255;index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+	User      User `gorm:"foreignKey:UserID"`
+}
+
+func (ElementLock) TableName() string {
+	return "element_lock"
+}
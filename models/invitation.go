@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// TeamInvitation invites an email address into a team. Only the SHA-256
+// hash of the emailed token is stored.
+type TeamInvitation struct {
+	ID         string         `gorm:"primaryKey;type:char(36)"`
+	TeamID     string         `gorm:"not null;type:char(36);index"`
+	Email      string         `gorm:"not null;size:255;index"`
+	Role       TeamMemberRole `gorm:"type:enum('owner','admin','editor','viewer');default:'editor'"`
+	TokenHash  string         `gorm:"not null;unique;type:char(64)"`
+	InvitedBy  string         `gorm:"not null;type:char(36)"`
+	ExpiresAt  time.Time      `gorm:"not null"`
+	AcceptedAt *time.Time
+	CreatedAt  time.Time
+	Team       Team `gorm:"foreignKey:TeamID"`
+	Inviter    User `gorm:"foreignKey:InvitedBy"`
+}
+
+func (TeamInvitation) TableName() string {
+	return "team_invitation"
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// Breakpoint is a viewport width at which element layouts may differ. It
+// applies to viewports up to MaxWidth pixels wide; zero means any width.
+type Breakpoint struct {
+	Name     string `json:"name"`
+	MaxWidth int    `json:"max_width"`
+}
+
+type Breakpoints []Breakpoint
+
+func (b *Breakpoints) Scan(value interface{}) error {
+	if value == nil {
+		*b = nil
+		return nil
+	}
+	data, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(data, b)
+}
+
+func (b Breakpoints) Value() (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+	return json.Marshal(b)
+}
+
+// LayoutOverride changes an element's box at one breakpoint. Nil fields
+// inherit from the next larger breakpoint.
+type LayoutOverride struct {
+	PositionX *int  `json:"position_x,omitempty"`
+	PositionY *int  `json:"position_y,omitempty"`
+	Width     *int  `json:"width,omitempty"`
+	Height    *int  `json:"height,omitempty"`
+	ZIndex    *int  `json:"z_index,omitempty"`
+	Hidden    *bool `json:"hidden,omitempty"`
+}
+
+// Empty reports whether the override changes nothing.
+func (o LayoutOverride) Empty() bool {
+	return o == LayoutOverride{}
+}
+
+// Layouts holds an element's overrides keyed by breakpoint name.
+type Layouts map[string]LayoutOverride
+
+func (l *Layouts) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+	data, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(data, l)
+}
+
+func (l Layouts) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
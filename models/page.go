@@ -12,9 +12,11 @@ type Page struct {
 	Name          string `gorm:"not null;size:100"`
 	Path          string `gorm:"not null;size:100"`
 	IsHomepage    bool   `gorm:"default:false"`
+	Position      int    `gorm:"not null;default:0"`
 	SEOTitle      string `gorm:"size:255"`
 	SEODescription string `gorm:"type:text"`
 	SEOKeywords   string `gorm:"size:255"`
+	ElementSeq    uint64 `gorm:"not null;default:0"`
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Project       Project   `gorm:"foreignKey:ProjectID"`
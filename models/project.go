@@ -23,6 +23,7 @@ type Project struct {
 	Domain      string        `gorm:"size:255"`
 	PublishedURL string       `gorm:"size:255"`
 	Status      ProjectStatus `gorm:"type:enum('draft','published','archived');default:'draft'"`
+	Breakpoints Breakpoints   `gorm:"type:json"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 	Team        Team         `gorm:"foreignKey:TeamID"`
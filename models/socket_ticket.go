@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// SocketTicket is a short-lived, single-use credential for opening a
+// WebSocket from a browser. Only the SHA-256 hash of the ticket is stored.
+type SocketTicket struct {
+	ID        string    `gorm:"primaryKey;type:char(64)"`
+	UserID    string    `gorm:"not null;type:char(36)"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+func (SocketTicket) TableName() string {
+	return "socket_ticket"
+}
@@ -0,0 +1,146 @@
+// Package policy decides what a team member may do based on their role.
+//
+// Every resource belongs to exactly one team: projects through TeamID,
+// pages and components through their project and elements through their
+// page. Permission is granted by the member's role in that team.
+package policy
+
+import (
+	"errors"
+
+	"website-builder/models"
+
+	"gorm.io/gorm"
+)
+
+// Action is something a user may do to a resource.
+type Action string
+
+const (
+	View            Action = "view"
+	Edit            Action = "edit"
+	Publish         Action = "publish"
+	ManageMembers   Action = "manage_members"
+	ManageTeam      Action = "manage_team"
+	DeleteProject   Action = "delete_project"
+	DeleteTeam      Action = "delete_team"
+	TransferProject Action = "transfer_project"
+	TransferTeam    Action = "transfer_team"
+)
+
+// permissions maps each role to the actions it grants.
+var permissions = map[models.TeamMemberRole][]Action{
+	models.Owner:  {View, Edit, Publish, ManageMembers, ManageTeam, DeleteProject, DeleteTeam, TransferProject, TransferTeam},
+	models.Admin:  {View, Edit, Publish, ManageMembers, ManageTeam, DeleteProject, TransferProject},
+	models.Editor: {View, Edit},
+	models.Viewer: {View},
+}
+
+// Allows reports whether role grants action.
+func Allows(role models.TeamMemberRole, action Action) bool {
+	for _, granted := range permissions[role] {
+		if granted == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Kind is the type of resource a permission is checked against.
+type Kind string
+
+const (
+	Team      Kind = "team"
+	Project   Kind = "project"
+	Page      Kind = "page"
+	Element   Kind = "element"
+	Component Kind = "component"
+)
+
+type Resource struct {
+	Kind Kind
+	ID   string
+}
+
+// ErrNotFound is returned when the resource does not exist.
+var ErrNotFound = errors.New("resource not found")
+
+// RoleKey is the gin context key under which the policy middleware stores
+// the caller's role in the resource's team.
+const RoleKey = "teamRole"
+
+type Policy struct {
+	db *gorm.DB
+}
+
+func New(db *gorm.DB) *Policy {
+	return &Policy{db: db}
+}
+
+// TeamOf resolves the team a resource belongs to.
+func (p *Policy) TeamOf(res Resource) (string, error) {
+	var teamID string
+	var err error
+
+	switch res.Kind {
+	case Team:
+		var team models.Team
+		err = p.db.Select("id").First(&team, "id = ?", res.ID).Error
+		teamID = team.ID
+	case Project:
+		var project models.Project
+		err = p.db.Select("team_id").First(&project, "id = ?", res.ID).Error
+		teamID = project.TeamID
+	case Page:
+		err = p.db.Model(&models.Page{}).
+			Select("project.team_id").
+			Joins("JOIN project ON project.id = page.project_id AND project.deleted_at IS NULL").
+			Where("page.id = ?", res.ID).
+			Scan(&teamID).Error
+	case Element:
+		err = p.db.Model(&models.Element{}).
+			Select("project.team_id").
+			Joins("JOIN page ON page.id = element.page_id AND page.deleted_at IS NULL").
+			Joins("JOIN project ON project.id = page.project_id AND project.deleted_at IS NULL").
+			Where("element.id = ?", res.ID).
+			Scan(&teamID).Error
+	case Component:
+		err = p.db.Model(&models.Component{}).
+			Select("project.team_id").
+			Joins("JOIN project ON project.id = component.project_id AND project.deleted_at IS NULL").
+			Where("component.id = ?", res.ID).
+			Scan(&teamID).Error
+	default:
+		return "", ErrNotFound
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && teamID == "") {
+		return "", ErrNotFound
+	}
+	return teamID, err
+}
+
+// Role returns userID's role in teamID and whether they are a member.
+func (p *Policy) Role(teamID string, userID string) (models.TeamMemberRole, bool) {
+	var member models.TeamMember
+	if err := p.db.Select("role").
+		Where("team_id = ? AND user_id = ?", teamID, userID).
+		First(&member).Error; err != nil {
+		return "", false
+	}
+	return member.Role, true
+}
+
+// Can reports whether userID may perform action on res. It also returns
+// the user's role in the owning team, empty for non-members.
+func (p *Policy) Can(userID string, action Action, res Resource) (bool, models.TeamMemberRole, error) {
+	teamID, err := p.TeamOf(res)
+	if err != nil {
+		return false, "", err
+	}
+	role, ok := p.Role(teamID, userID)
+	if !ok {
+		return false, "", nil
+	}
+	return Allows(role, action), role, nil
+}
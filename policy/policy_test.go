@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+
+	"website-builder/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		action Action
+		owner  bool
+		admin  bool
+		editor bool
+		viewer bool
+	}{
+		{View, true, true, true, true},
+		{Edit, true, true, true, false},
+		{Publish, true, true, false, false},
+		{ManageMembers, true, true, false, false},
+		{ManageTeam, true, true, false, false},
+		{DeleteProject, true, true, false, false},
+		{DeleteTeam, true, false, false, false},
+		{TransferProject, true, true, false, false},
+		{TransferTeam, true, false, false, false},
+	}
+	for _, tt := range tests {
+		for role, want := range map[models.TeamMemberRole]bool{
+			models.Owner:  tt.owner,
+			models.Admin:  tt.admin,
+			models.Editor: tt.editor,
+			models.Viewer: tt.viewer,
+		} {
+			if got := Allows(role, tt.action); got != want {
+				t.Errorf("Allows(%s, %s) = %v, want %v", role, tt.action, got, want)
+			}
+		}
+	}
+}
+
+func TestAllowsUnknownRole(t *testing.T) {
+	if Allows("", View) || Allows("guest", View) {
+		t.Fatal("a role outside the team grants access")
+	}
+}
+
+// newTestPolicy returns a policy over an in-memory database holding the
+// columns TeamOf and Role read. Team t1 owns project p1 with page pg1,
+// element e1 and component c1. Project gone and page pg-deleted are
+// soft-deleted, so nothing under them resolves.
+func newTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := []string{
+		"CREATE TABLE team (id TEXT PRIMARY KEY, deleted_at DATETIME)",
+		"CREATE TABLE team_member (id INTEGER PRIMARY KEY, team_id TEXT, user_id TEXT, role TEXT, deleted_at DATETIME)",
+		"CREATE TABLE project (id TEXT PRIMARY KEY, team_id TEXT, deleted_at DATETIME)",
+		"CREATE TABLE page (id TEXT PRIMARY KEY, project_id TEXT, deleted_at DATETIME)",
+		"CREATE TABLE element (id TEXT PRIMARY KEY, page_id TEXT, deleted_at DATETIME)",
+		"CREATE TABLE component (id TEXT PRIMARY KEY, project_id TEXT, deleted_at DATETIME)",
+
+		"INSERT INTO team (id) VALUES ('t1'), ('t2')",
+		"INSERT INTO team_member (team_id, user_id, role) VALUES ('t1', 'alice', 'admin'), ('t1', 'bob', 'viewer'), ('t2', 'bob', 'owner')",
+		"INSERT INTO team_member (team_id, user_id, role, deleted_at) VALUES ('t1', 'carol', 'owner', '2024-01-01')",
+		"INSERT INTO project (id, team_id) VALUES ('p1', 't1'), ('p2', 't2')",
+		"INSERT INTO project (id, team_id, deleted_at) VALUES ('gone', 't1', '2024-01-01')",
+		"INSERT INTO page (id, project_id) VALUES ('pg1', 'p1'), ('pg2', 'p2'), ('pg-gone', 'gone')",
+		"INSERT INTO page (id, project_id, deleted_at) VALUES ('pg-deleted', 'p1', '2024-01-01')",
+		"INSERT INTO element (id, page_id) VALUES ('e1', 'pg1'), ('e2', 'pg2'), ('e-gone', 'pg-gone'), ('e-orphan', 'pg-deleted')",
+		"INSERT INTO component (id, project_id) VALUES ('c1', 'p1'), ('c2', 'p2'), ('c-gone', 'gone')",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	return New(db)
+}
+
+func TestTeamOf(t *testing.T) {
+	p := newTestPolicy(t)
+	tests := []struct {
+		res  Resource
+		want string
+	}{
+		{Resource{Team, "t1"}, "t1"},
+		{Resource{Project, "p1"}, "t1"},
+		{Resource{Project, "p2"}, "t2"},
+		{Resource{Page, "pg1"}, "t1"},
+		{Resource{Page, "pg2"}, "t2"},
+		{Resource{Element, "e1"}, "t1"},
+		{Resource{Element, "e2"}, "t2"},
+		{Resource{Component, "c1"}, "t1"},
+		{Resource{Component, "c2"}, "t2"},
+	}
+	for _, tt := range tests {
+		got, err := p.TeamOf(tt.res)
+		if err != nil || got != tt.want {
+			t.Errorf("TeamOf(%s %s) = %q, %v; want %q", tt.res.Kind, tt.res.ID, got, err, tt.want)
+		}
+	}
+}
+
+func TestTeamOfNotFound(t *testing.T) {
+	p := newTestPolicy(t)
+	for _, res := range []Resource{
+		{Team, "missing"},
+		{Project, "missing"},
+		{Project, "gone"},
+		{Page, "missing"},
+		{Page, "pg-gone"},
+		{Page, "pg-deleted"},
+		{Element, "missing"},
+		{Element, "e-gone"},
+		{Element, "e-orphan"},
+		{Component, "missing"},
+		{Component, "c-gone"},
+		{Kind("comment"), "e1"},
+	} {
+		if _, err := p.TeamOf(res); !errors.Is(err, ErrNotFound) {
+			t.Errorf("TeamOf(%s %s) error = %v, want ErrNotFound", res.Kind, res.ID, err)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	p := newTestPolicy(t)
+	tests := []struct {
+		user   string
+		action Action
+		res    Resource
+		want   bool
+		role   models.TeamMemberRole
+	}{
+		{"alice", Edit, Resource{Element, "e1"}, true, models.Admin},
+		{"alice", DeleteTeam, Resource{Team, "t1"}, false, models.Admin},
+		{"alice", View, Resource{Page, "pg2"}, false, ""},
+		{"bob", View, Resource{Component, "c1"}, true, models.Viewer},
+		{"bob", Edit, Resource{Component, "c1"}, false, models.Viewer},
+		{"bob", DeleteTeam, Resource{Project, "p2"}, true, models.Owner},
+		// Removed members keep no access
+		{"carol", View, Resource{Project, "p1"}, false, ""},
+	}
+	for _, tt := range tests {
+		got, role, err := p.Can(tt.user, tt.action, tt.res)
+		if err != nil {
+			t.Errorf("Can(%s, %s, %s %s): %v", tt.user, tt.action, tt.res.Kind, tt.res.ID, err)
+			continue
+		}
+		if got != tt.want || role != tt.role {
+			t.Errorf("Can(%s, %s, %s %s) = %v, %q; want %v, %q",
+				tt.user, tt.action, tt.res.Kind, tt.res.ID, got, role, tt.want, tt.role)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+// Package render turns a project into a static website: one HTML document
+// per page, each with the CSS its elements need inlined.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+
+	"website-builder/elements"
+	"website-builder/layout"
+	"website-builder/models"
+)
+
+// Input is everything a project's site is rendered from.
+type Input struct {
+	Project    models.Project
+	Pages      []models.Page
+	Elements   []models.Element
+	Components []models.Component
+}
+
+// Page is one rendered document.
+type Page struct {
+	Name string
+	// Path is the page's URL path and Files where it lives in the site,
+	// e.g. "/about" and "about/index.html". The homepage is also written
+	// to the root "index.html".
+	Path     string
+	Files    []string
+	Homepage bool
+	HTML     []byte
+}
+
+// ErrPathConflict is returned when two pages would be written to the same
+// file, as when a page other than the homepage has the path "/".
+var ErrPathConflict = errors.New("pages share a path")
+
+// Site is a rendered project, pages in navigation order.
+type Site struct {
+	Name  string
+	Pages []Page
+}
+
+// Find returns the page served at path.
+func (s *Site) Find(path string) (*Page, bool) {
+	if path == "/" {
+		return s.Homepage()
+	}
+	for i := range s.Pages {
+		if s.Pages[i].Path == path {
+			return &s.Pages[i], true
+		}
+	}
+	return nil, false
+}
+
+// Homepage returns the page served at the root of the site.
+func (s *Site) Homepage() (*Page, bool) {
+	for i := range s.Pages {
+		if s.Pages[i].Homepage {
+			return &s.Pages[i], true
+		}
+	}
+	return nil, false
+}
+
+// Render renders every page of the project.
+func Render(in *Input) (*Site, error) {
+	breakpoints := layout.Resolve(in.Project.Breakpoints)
+	components := make(map[string]models.Component, len(in.Components))
+	for _, component := range in.Components {
+		components[component.ID] = component
+	}
+	byPage := make(map[string][]models.Element, len(in.Pages))
+	for _, element := range in.Elements {
+		byPage[element.PageID] = append(byPage[element.PageID], element)
+	}
+
+	site := &Site{Name: in.Project.Name, Pages: make([]Page, 0, len(in.Pages))}
+	owners := make(map[string]string, len(in.Pages)+1)
+	for _, page := range in.Pages {
+		files := []string{fileFor(page.Path)}
+		if page.IsHomepage && files[0] != "index.html" {
+			files = append(files, "index.html")
+		}
+		for _, file := range files {
+			if owner, taken := owners[file]; taken {
+				return nil, fmt.Errorf("%w: %s and %s are both written to %s", ErrPathConflict, owner, page.Path, file)
+			}
+			owners[file] = page.Path
+		}
+
+		r := &pageRenderer{breakpoints: breakpoints, components: components, types: map[string]bool{}}
+		html, err := r.document(&in.Project, &page, byPage[page.ID])
+		if err != nil {
+			return nil, fmt.Errorf("render page %s: %w", page.Path, err)
+		}
+		site.Pages = append(site.Pages, Page{
+			Name:     page.Name,
+			Path:     page.Path,
+			Files:    files,
+			Homepage: page.IsHomepage,
+			HTML:     html,
+		})
+	}
+	return site, nil
+}
+
+// fileFor maps a page path to a file that static hosts serve at it.
+func fileFor(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "index.html"
+	}
+	return path + "/index.html"
+}
+
+// node is an element placed on a page. Elements of component instances
+// are expanded into nodes of their own.
+type node struct {
+	id       string
+	element  models.Element
+	boxes    map[string]layout.Box
+	children []*node
+}
+
+type pageRenderer struct {
+	breakpoints models.Breakpoints
+	components  map[string]models.Component
+	// types records which element types the page uses, so only their
+	// styles are included
+	types map[string]bool
+	css   strings.Builder
+}
+
+var documentTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- if .Description}}
+<meta name="description" content="{{.Description}}">
+{{- end}}
+{{- if .Keywords}}
+<meta name="keywords" content="{{.Keywords}}">
+{{- end}}
+<style>
+{{.CSS}}</style>
+</head>
+<body>
+<main class="wb-page">
+{{.Body}}
+</main>
+</body>
+</html>
+`))
+
+func (r *pageRenderer) document(project *models.Project, page *models.Page, pageElements []models.Element) ([]byte, error) {
+	roots := r.tree(pageElements)
+
+	var body strings.Builder
+	for _, root := range roots {
+		body.WriteString(string(r.element(root, layout.Flow{})))
+		body.WriteString("\n")
+	}
+
+	title := page.SEOTitle
+	if title == "" {
+		title = page.Name + " | " + project.Name
+	}
+
+	var out bytes.Buffer
+	err := documentTemplate.Execute(&out, struct {
+		Title       string
+		Description string
+		Keywords    string
+		CSS         template.CSS
+		Body        template.HTML
+	}{
+		Title:       title,
+		Description: page.SEODescription,
+		Keywords:    page.SEOKeywords,
+		CSS:         template.CSS(r.stylesheet(roots)),
+		Body:        template.HTML(body.String()),
+	})
+	return out.Bytes(), err
+}
+
+// tree nests a page's elements and expands component instances. Elements
+// whose parent is missing are treated as roots.
+func (r *pageRenderer) tree(pageElements []models.Element) []*node {
+	nodes := make(map[string]*node, len(pageElements))
+	for _, element := range pageElements {
+		nodes[element.ID] = r.node("el-"+element.ID, element)
+	}
+
+	var roots []*node
+	for _, element := range pageElements {
+		n := nodes[element.ID]
+		if element.Type == models.ComponentElement {
+			n.children = append(n.children, r.instance(n)...)
+		}
+		if element.ParentElementID != nil {
+			if parent, ok := nodes[*element.ParentElementID]; ok && parent != n {
+				parent.children = append(parent.children, n)
+				continue
+			}
+		}
+		roots = append(roots, n)
+	}
+	return roots
+}
+
+func (r *pageRenderer) node(id string, element models.Element) *node {
+	return &node{
+		id:      id,
+		element: element,
+		boxes:   layout.Cascade(r.breakpoints, layout.Base(&element), element.Layouts),
+	}
+}
+
+// instance expands the component placed by n, with n's overrides applied.
+// Node IDs are prefixed with the instance's so every copy is unique.
+func (r *pageRenderer) instance(n *node) []*node {
+	component, ok := r.components[elements.DataString(n.element.Data, "component_id", "")]
+	if !ok {
+		return nil
+	}
+	overrides, _ := n.element.Data["overrides"].(map[string]interface{})
+
+	nodes := make(map[string]*node, len(component.Elements))
+	var roots []*node
+	// Nodes are stored parents first
+	for _, source := range component.Elements {
+		patch, _ := overrides[source.ID].(map[string]interface{})
+		child := r.node(n.id+"-"+source.ID, models.Element{
+			ID:        source.ID,
+			Type:      source.Type,
+			Data:      models.ApplyOverride(source.Data, patch),
+			PositionX: source.PositionX,
+			PositionY: source.PositionY,
+			Width:     source.Width,
+			Height:    source.Height,
+			ZIndex:    source.ZIndex,
+		})
+		nodes[source.ID] = child
+		if source.ParentElementID == nil {
+			roots = append(roots, child)
+		} else if parent, ok := nodes[*source.ParentElementID]; ok {
+			parent.children = append(parent.children, child)
+		}
+	}
+	return roots
+}
+
+// element renders n and its children. parent is the layout of the
+// section n sits in; page roots are placed absolutely.
+func (r *pageRenderer) element(n *node, parent layout.Flow) template.HTML {
+	elementType := string(n.element.Type)
+	r.types[elementType] = true
+
+	var flow layout.Flow
+	if n.element.Type == models.SectionElement {
+		flow = elements.SectionFlow(n.element.Data)
+	}
+
+	// Children flow, and stack, in z-index order
+	sort.SliceStable(n.children, func(i, j int) bool {
+		return n.children[i].element.ZIndex < n.children[j].element.ZIndex
+	})
+	var children strings.Builder
+	for _, child := range n.children {
+		children.WriteString(string(r.element(child, flow)))
+	}
+
+	rendered := elements.Rendered{HTML: template.HTML(children.String())}
+	if t, ok := elements.Lookup(elementType); ok {
+		rendered = t.Render(elements.RenderInput{
+			ID:       n.element.ID,
+			Data:     n.element.Data,
+			Children: template.HTML(children.String()),
+		})
+	}
+
+	// Type styles come first so the layout's display:none can override
+	// them where the element is hidden
+	selector := "#" + cssIdent(n.id)
+	r.css.WriteString(layout.Rule("", selector, rendered.Style))
+	r.css.WriteString(layout.CSS(selector, parent, r.breakpoints, n.boxes))
+
+	tag := "div"
+	if n.element.Type == models.SectionElement {
+		tag = "section"
+	}
+	return template.HTML(fmt.Sprintf(`<%s id="%s" class="wb-el wb-el-%s">%s</%s>`,
+		tag, template.HTMLEscapeString(n.id), template.HTMLEscapeString(elementType), rendered.HTML, tag))
+}
+
+// cssIdent escapes s for use as a CSS identifier, so element IDs stored
+// before they were validated cannot break out of a selector.
+func cssIdent(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == '-', r >= 0x80:
+			b.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "\\%x ", r)
+		}
+	}
+	return b.String()
+}
+
+// stylesheet assembles the page's CSS: the base rules, the styles of the
+// element types in use, the size of the page at every breakpoint and the
+// rules of each element.
+func (r *pageRenderer) stylesheet(roots []*node) string {
+	var b strings.Builder
+	b.WriteString(baseStyles)
+
+	types := make([]string, 0, len(r.types))
+	for name := range r.types {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	for _, name := range types {
+		b.WriteString(typeStyles[name])
+	}
+
+	// Absolutely placed roots do not size the page, so it is given the
+	// extent of its visible content at every breakpoint
+	var previous map[string]string
+	for _, bp := range r.breakpoints {
+		width, height := 0, 0
+		for _, root := range roots {
+			box := root.boxes[bp.Name]
+			if box.Hidden {
+				continue
+			}
+			width = max(width, box.PositionX+box.Width)
+			height = max(height, box.PositionY+box.Height)
+		}
+		size := map[string]string{"width": fmt.Sprintf("%dpx", width), "height": fmt.Sprintf("%dpx", height)}
+		changed := map[string]string{}
+		for property, value := range size {
+			if previous[property] != value {
+				changed[property] = value
+			}
+		}
+		previous = size
+		b.WriteString(layout.Rule(layout.MediaQuery(bp), ".wb-page", changed))
+	}
+
+	b.WriteString(r.css.String())
+	// Data such as image URLs ends up in the stylesheet; keep it from
+	// closing the style element
+	return strings.ReplaceAll(b.String(), "</", `<\/`)
+}
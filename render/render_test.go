@@ -0,0 +1,269 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"website-builder/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// data decodes Data the way it comes out of the database.
+func data(t *testing.T, raw string) models.JSON {
+	t.Helper()
+	var d models.JSON
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		t.Fatalf("bad test data %s: %v", raw, err)
+	}
+	return d
+}
+
+func element(id string, elementType models.ElementType, d models.JSON, x, y, w, h, z int) models.Element {
+	return models.Element{
+		ID:        id,
+		PageID:    "home",
+		Type:      elementType,
+		Data:      d,
+		PositionX: x,
+		PositionY: y,
+		Width:     w,
+		Height:    h,
+		ZIndex:    z,
+	}
+}
+
+func child(parent string, e models.Element) models.Element {
+	e.ParentElementID = &parent
+	return e
+}
+
+func intPtr(n int) *int    { return &n }
+func boolPtr(b bool) *bool { return &b }
+
+func input(elements []models.Element, components ...models.Component) *Input {
+	return &Input{
+		Project:    models.Project{ID: "project", Name: "Acme"},
+		Pages:      []models.Page{{ID: "home", ProjectID: "project", Name: "Home", Path: "/", IsHomepage: true}},
+		Elements:   elements,
+		Components: components,
+	}
+}
+
+// section returns a section with three children, so its layout has
+// something to place.
+func section(t *testing.T, raw string) []models.Element {
+	return []models.Element{
+		element("section", models.SectionElement, data(t, raw), 0, 0, 960, 400, 0),
+		child("section", element("first", models.TextElement, data(t, `{"content":"First"}`), 40, 40, 200, 60, 0)),
+		child("section", element("second", models.TextElement, data(t, `{"content":"Second"}`), 300, 40, 240, 80, 1)),
+		child("section", element("third", models.ButtonElement, data(t, `{"label":"Third"}`), 600, 40, 160, 48, 2)),
+	}
+}
+
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *Input
+	}{
+		{"text", input([]models.Element{
+			func() models.Element {
+				e := element("heading", models.TextElement,
+					data(t, `{"content":"Hello <world>\nSecond line","tag":"h1","font_size":48,"font_weight":"700","color":"#111111","align":"center"}`),
+					100, 80, 760, 120, 0)
+				e.Layouts = models.Layouts{
+					"tablet": {PositionX: intPtr(40), Width: intPtr(600)},
+					"mobile": {Hidden: boolPtr(true)},
+				}
+				return e
+			}(),
+		})},
+		{"image", input([]models.Element{
+			element("photo", models.ImageElement, data(t, `{"src":"https://example.com/a.jpg","alt":"A \"quoted\" photo","fit":"contain","link":"https://example.com"}`), 0, 0, 400, 300, 0),
+		})},
+		{"button", input([]models.Element{
+			element("cta", models.ButtonElement, data(t, `{"label":"Sign up","href":"https://example.com/signup","target":"_blank","variant":"outline","background_color":"#ff0000","color":"#ffffff"}`), 20, 20, 180, 48, 0),
+		})},
+		{"video", input([]models.Element{
+			element("clip", models.VideoElement, data(t, `{"src":"https://www.youtube.com/watch?v=dQw4w9WgXcQ","provider":"youtube","autoplay":true,"muted":true}`), 0, 0, 640, 360, 0),
+			element("file", models.VideoElement, data(t, `{"src":"https://example.com/clip.mp4","provider":"file","controls":true,"loop":true}`), 0, 400, 640, 360, 1),
+		})},
+		{"form", input([]models.Element{
+			element("contact", models.FormElement, data(t, `{
+				"fields": [
+					{"name":"name","label":"Name","type":"text","required":true},
+					{"name":"email","label":"Email","type":"email","required":true},
+					{"name":"topic","label":"Topic","type":"select","options":["Sales","Support"]},
+					{"name":"message","label":"Message","type":"textarea"},
+					{"name":"subscribe","label":"Keep me posted","type":"checkbox"}
+				],
+				"submit_label":"Send",
+				"action":"https://example.com/contact"
+			}`), 0, 0, 480, 520, 0),
+		})},
+		{"section_absolute", input(section(t, `{"background_color":"#f3f4f6"}`))},
+		{"section_vstack", input(section(t, `{"layout":"vstack","gap":16,"padding":24,"align":"stretch","justify":"center"}`))},
+		{"section_hstack", input(section(t, `{"layout":"hstack","gap":12,"align":"center","justify":"space-between","wrap":true,"reverse":true}`))},
+		{"section_grid", input(section(t, `{"layout":"grid","columns":3,"gap":8,"padding":16}`))},
+		{"section_background", input(section(t, `{"background_image":"https://example.com/a b\"c\\d.jpg?x=1&y=(2)\n</style><script>alert(1)</script>"}`))},
+		{"divider", input([]models.Element{
+			element("rule", models.DividerElement, data(t, `{"color":"#cccccc","thickness":2,"style":"dashed"}`), 0, 100, 960, 2, 0),
+		})},
+		{"map", input([]models.Element{
+			element("office", models.MapElement, data(t, `{"address":"1 Main St, Springfield","zoom":12}`), 0, 0, 600, 400, 0),
+		})},
+		{"social", input([]models.Element{
+			element("links", models.SocialElement, data(t, `{"links":[{"network":"github","url":"https://github.com/acme"},{"network":"email","url":"mailto:hi@example.com"}],"size":32,"color":"#333333"}`), 0, 0, 300, 40, 0),
+		})},
+		{"component", input(
+			[]models.Element{
+				element("header", models.ComponentElement, data(t, `{"component_id":"nav","overrides":{"title":{"content":"Acme Inc"},"cta":{"href":null}}}`), 0, 0, 960, 80, 0),
+				element("footer", models.ComponentElement, data(t, `{"component_id":"nav"}`), 0, 600, 960, 80, 1),
+			},
+			models.Component{
+				ID:        "nav",
+				ProjectID: "project",
+				Name:      "Navigation",
+				Width:     960,
+				Height:    80,
+				Elements: models.ComponentNodes{
+					{ID: "bar", Type: models.SectionElement, Data: data(t, `{"layout":"hstack","justify":"space-between","align":"center","padding":16}`), Width: 960, Height: 80},
+					{ID: "title", Type: models.TextElement, Data: data(t, `{"content":"Acme","tag":"h2"}`), Width: 200, Height: 40, ParentElementID: func() *string { s := "bar"; return &s }()},
+					{ID: "cta", Type: models.ButtonElement, Data: data(t, `{"label":"Contact","href":"/contact"}`), Width: 120, Height: 40, ZIndex: 1, ParentElementID: func() *string { s := "bar"; return &s }()},
+				},
+			},
+		)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site, err := Render(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := site.Pages[0].HTML
+			golden := filepath.Join("testdata", tt.name+".html")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s does not match the rendered page:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+// TestRenderIsStable renders the same project twice and expects the same
+// bytes, since output feeds golden files and static hosts' caches.
+func TestRenderIsStable(t *testing.T) {
+	elements := section(t, `{"layout":"grid","columns":2}`)
+	first, err := Render(input(elements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		again, err := Render(input(elements))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(first.Pages[0].HTML, again.Pages[0].HTML) {
+			t.Fatal("rendering the same project twice gave different output")
+		}
+	}
+}
+
+func TestRenderEscapesIDs(t *testing.T) {
+	id := `"><script>alert(1)</script>`
+	site, err := Render(input([]models.Element{
+		element(id, models.TextElement, data(t, `{"content":"x"}`), 0, 0, 10, 10, 0),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(site.Pages[0].HTML)
+	if strings.Contains(html, "<script>") {
+		t.Fatalf("element ID was not escaped:\n%s", html)
+	}
+	if !strings.Contains(html, `id="el-&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`) {
+		t.Fatalf("element ID is missing from its attribute:\n%s", html)
+	}
+}
+
+func TestCSSIdent(t *testing.T) {
+	tests := map[string]string{
+		"el-0b6f-4c":     "el-0b6f-4c",
+		"1st":            `\31 st`,
+		`a"b{c}</style>`: `a\22 b\7b c\7d \3c \2f style\3e `,
+		"é":              "é",
+	}
+	for in, want := range tests {
+		if got := cssIdent(in); got != want {
+			t.Errorf("cssIdent(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHomepageFiles(t *testing.T) {
+	in := input(nil)
+	in.Pages = []models.Page{
+		{ID: "home", Name: "Home", Path: "/home", IsHomepage: true},
+		{ID: "about", Name: "About", Path: "/about/team"},
+	}
+	site, err := Render(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := site.Pages[0].Files, []string{"home/index.html", "index.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("homepage files = %v, want %v", got, want)
+	}
+	if got, want := site.Pages[1].Files, []string{"about/team/index.html"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("page files = %v, want %v", got, want)
+	}
+	for _, path := range []string{"/", "/home"} {
+		if page, ok := site.Find(path); !ok || page.Name != "Home" {
+			t.Errorf("Find(%q) did not return the homepage", path)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := site.WriteZip(&archive); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	if want := []string{"home/index.html", "index.html", "about/team/index.html"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("zip entries = %v, want %v", names, want)
+	}
+}
+
+func TestRenderPathConflict(t *testing.T) {
+	in := input(nil)
+	in.Pages = []models.Page{
+		{ID: "home", Name: "Home", Path: "/home", IsHomepage: true},
+		{ID: "root", Name: "Root", Path: "/"},
+	}
+	if _, err := Render(in); !errors.Is(err, ErrPathConflict) {
+		t.Fatalf("Render = %v, want ErrPathConflict", err)
+	}
+}
@@ -0,0 +1,65 @@
+package render
+
+import (
+	"archive/zip"
+	"io"
+
+	"gorm.io/gorm"
+)
+
+// Load reads everything Render needs for a project.
+func Load(db *gorm.DB, projectID string) (*Input, error) {
+	in := &Input{}
+	if err := db.First(&in.Project, "id = ?", projectID).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("project_id = ?", projectID).
+		Order("position").Order("created_at").
+		Find(&in.Pages).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("project_id = ?", projectID).Find(&in.Components).Error; err != nil {
+		return nil, err
+	}
+	if len(in.Pages) == 0 {
+		return in, nil
+	}
+
+	pageIDs := make([]string, 0, len(in.Pages))
+	for _, page := range in.Pages {
+		pageIDs = append(pageIDs, page.ID)
+	}
+	if err := db.Where("page_id IN ?", pageIDs).
+		Order("z_index").Order("created_at").
+		Find(&in.Elements).Error; err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// LoadAndRender renders a project straight from the database.
+func LoadAndRender(db *gorm.DB, projectID string) (*Site, error) {
+	in, err := Load(db, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return Render(in)
+}
+
+// WriteZip writes the site as a zip archive ready to upload to a static
+// host.
+func (s *Site) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, page := range s.Pages {
+		for _, name := range page.Files {
+			file, err := archive.Create(name)
+			if err != nil {
+				return err
+			}
+			if _, err := file.Write(page.HTML); err != nil {
+				return err
+			}
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,44 @@
+package render
+
+import "website-builder/models"
+
+// baseStyles reset the page and make every element a box its content
+// fills.
+const baseStyles = `*,*::before,*::after{box-sizing:border-box}
+body{margin:0;font-family:system-ui,-apple-system,"Segoe UI",Roboto,sans-serif;line-height:1.5;color:#111827}
+.wb-page{position:relative;max-width:100%;margin:0 auto}
+.wb-el>iframe,.wb-el>video,.wb-el>img,.wb-el>a>img{display:block}
+`
+
+// typeStyles hold the rules shared by every element of a built-in type,
+// keyed by type name. Element boxes carry the class wb-el-<type>; the
+// wb-* classes are the type renderers' own markup. Per-element values
+// arrive through the custom properties the renderers set.
+var typeStyles = map[string]string{
+	string(models.TextElement): `.wb-el-text>*{margin:0;overflow-wrap:break-word}
+`,
+	string(models.ImageElement): `.wb-el-image a{display:block;width:100%;height:100%}
+`,
+	string(models.ButtonElement): `.wb-button{display:flex;align-items:center;justify-content:center;width:100%;height:100%;padding:0 1em;border:2px solid var(--wb-button-background,#2563eb);border-radius:6px;background:var(--wb-button-background,#2563eb);color:var(--wb-button-color,#fff);font-weight:600;text-decoration:none;cursor:pointer}
+.wb-button-secondary{border-color:var(--wb-button-background,#e5e7eb);background:var(--wb-button-background,#e5e7eb);color:var(--wb-button-color,#111827)}
+.wb-button-outline{background:transparent;color:var(--wb-button-color,var(--wb-button-background,#2563eb))}
+.wb-button-link{border-color:transparent;background:transparent;color:var(--wb-button-color,#2563eb);text-decoration:underline}
+`,
+	string(models.VideoElement): `.wb-el-video{background:#000}
+`,
+	string(models.FormElement): `.wb-form{display:flex;flex-direction:column;gap:12px}
+.wb-form label{display:flex;flex-direction:column;gap:4px;font-size:14px}
+.wb-form input,.wb-form select,.wb-form textarea{padding:8px 10px;border:1px solid #d1d5db;border-radius:4px;font:inherit}
+.wb-form input[type=checkbox]{align-self:flex-start}
+.wb-form button{align-self:flex-start;padding:8px 16px;border:0;border-radius:6px;background:#2563eb;color:#fff;font:inherit;font-weight:600;cursor:pointer}
+`,
+	string(models.SectionElement): `.wb-el-section{overflow:hidden}
+`,
+	string(models.DividerElement): `.wb-el-divider>hr{width:100%}
+`,
+	string(models.MapElement): `.wb-el-map{background:#e5e7eb}
+`,
+	string(models.SocialElement): `.wb-social{display:flex;flex-wrap:wrap;gap:8px;margin:0;padding:0;list-style:none}
+.wb-social a{display:flex;align-items:center;justify-content:center;min-width:var(--wb-social-size);height:var(--wb-social-size);padding:0 .5em;border:1px solid currentColor;border-radius:calc(var(--wb-social-size)/2);color:inherit;font-size:calc(var(--wb-social-size)/2);text-decoration:none;text-transform:capitalize}
+`,
+}
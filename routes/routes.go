@@ -2,24 +2,58 @@ package routes
 
 import (
 	"website-builder/controllers"
+	"website-builder/mailer"
 	"website-builder/middleware"
+	"website-builder/policy"
 	"website-builder/websocket"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(r *gin.Engine, db *gorm.DB, hub *websocket.Hub) {
+func SetupRoutes(r *gin.Engine, db *gorm.DB, hub *websocket.Hub, mail mailer.Mailer, allowedOrigins []string) {
+	// Every team, project, page, component and element route is gated by the
+	// role policy
+	permissions := policy.New(db)
+	can := func(action policy.Action, locate middleware.Locator) gin.HandlerFunc {
+		return middleware.Authorize(permissions, action, locate)
+	}
+	team := middleware.Param("id", policy.Team)
+	project := middleware.Param("id", policy.Project)
+	page := middleware.Param("id", policy.Page)
+	element := middleware.Param("id", policy.Element)
+	component := middleware.Param("id", policy.Component)
+
 	// Initialize controllers
-	authController := controllers.NewAuthController(db)
+	authController := controllers.NewAuthController(db, hub)
 	projectController := controllers.NewProjectController(db, hub)
-	elementController := controllers.NewElementController(db)
+	elementController := controllers.NewElementController(db, hub)
+	presenceController := controllers.NewPresenceController(db, hub)
+	lockController := controllers.NewLockController(db, hub)
+	wsController := controllers.NewWebSocketController(db, hub, allowedOrigins)
+	teamController := controllers.NewTeamController(db, hub)
+	pageController := controllers.NewPageController(db, hub)
+	invitationController := controllers.NewInvitationController(db, hub, mail)
+	componentController := controllers.NewComponentController(db, hub)
+
+	// Only users who may view a team or project may join its room
+	hub.Authorize = controllers.RoomAuthorizer(permissions)
+	elementController.RegisterSocketHandlers()
+	presenceController.RegisterSocketHandlers()
+	lockController.RegisterSocketHandlers()
+	go presenceController.ExpireSessions()
+	go lockController.ExpireLocks()
+	go controllers.PurgeDeleted(db)
 
 	// Public routes (no auth required)
 	api := r.Group("/api")
 	{
 		api.POST("/login", authController.Login)
 		api.POST("/register", authController.Register)
+		api.GET("/invitations/:token", invitationController.GetInvitation)
+
+		// WebSocket route authenticates from header, subprotocol or ticket
+		api.GET("/ws", middleware.WebSocketAuthMiddleware(wsController.RedeemTicket), wsController.Connect)
 	}
 
 	// Protected routes (require auth)
@@ -28,22 +62,63 @@ func SetupRoutes(r *gin.Engine, db *gorm.DB, hub *websocket.Hub) {
 		// User routes
 		protected.GET("/me", authController.GetCurrentUser)
 
+		// Team routes
+		protected.POST("/teams", teamController.CreateTeam)
+		protected.GET("/teams", teamController.GetTeams)
+		protected.GET("/teams/:id", can(policy.View, team), teamController.GetTeam)
+		protected.PUT("/teams/:id", can(policy.ManageTeam, team), teamController.UpdateTeam)
+		protected.DELETE("/teams/:id", can(policy.DeleteTeam, team), teamController.DeleteTeam)
+		protected.POST("/teams/:id/transfer", can(policy.TransferTeam, team), teamController.TransferOwnership)
+		protected.GET("/teams/:id/members", can(policy.View, team), teamController.GetMembers)
+		protected.PUT("/teams/:id/members/:userId", can(policy.ManageMembers, team), teamController.UpdateMemberRole)
+		protected.DELETE("/teams/:id/members/:userId", can(policy.View, team), teamController.RemoveMember)
+		protected.POST("/teams/:id/invitations", can(policy.ManageMembers, team), invitationController.CreateInvitation)
+		protected.GET("/teams/:id/invitations", can(policy.ManageMembers, team), invitationController.GetInvitations)
+		protected.DELETE("/teams/:id/invitations/:invitationId", can(policy.ManageMembers, team), invitationController.RevokeInvitation)
+		protected.POST("/invitations/accept", invitationController.AcceptInvitation)
+
 		// Project routes
-		protected.POST("/projects", projectController.CreateProject)
-		protected.GET("/projects", projectController.GetProjects)
-		protected.GET("/projects/:id", projectController.GetProject)
-		protected.PUT("/projects/:id", projectController.UpdateProject)
-		protected.DELETE("/projects/:id", projectController.DeleteProject)
-
-		protected.POST("/elements", elementController.CreateElement)
-	protected.GET("/elements/:id", elementController.GetElement)
-	protected.PUT("/elements/:id", elementController.UpdateElement)
-	protected.DELETE("/elements/:id", elementController.DeleteElement)
-	protected.GET("/elements", elementController.ListElements)
-
-		// WebSocket route
-		protected.GET("/ws", func(c *gin.Context) {
-			controllers.WebSocketHandler(c, hub)
-		})
+		protected.POST("/projects", can(policy.Edit, middleware.Body("team_id", policy.Team)), projectController.CreateProject)
+		protected.GET("/projects", can(policy.View, middleware.Query("team_id", policy.Team)), projectController.GetProjects)
+		protected.GET("/projects/:id", can(policy.View, project), projectController.GetProject)
+		protected.GET("/projects/:id/tree", can(policy.View, project), projectController.GetProjectTree)
+		protected.GET("/projects/:id/preview", can(policy.View, project), projectController.PreviewProject)
+		protected.GET("/projects/:id/export", can(policy.View, project), projectController.ExportProject)
+		protected.PUT("/projects/:id", can(policy.Edit, project), projectController.UpdateProject)
+		protected.DELETE("/projects/:id", can(policy.DeleteProject, project), projectController.DeleteProject)
+		protected.POST("/projects/:id/transfer", can(policy.TransferProject, project), projectController.TransferProject)
+		protected.GET("/projects/:id/presence", can(policy.View, project), presenceController.GetPresence)
+		protected.GET("/projects/:id/locks", can(policy.View, project), lockController.GetLocks)
+
+		// Page routes
+		protected.POST("/projects/:id/pages", can(policy.Edit, project), pageController.CreatePage)
+		protected.GET("/projects/:id/pages", can(policy.View, project), pageController.GetPages)
+		protected.PUT("/projects/:id/pages/order", can(policy.Edit, project), pageController.ReorderPages)
+		protected.GET("/pages/:id", can(policy.View, page), pageController.GetPage)
+		protected.PUT("/pages/:id", can(policy.Edit, page), pageController.UpdatePage)
+		protected.DELETE("/pages/:id", can(policy.Edit, page), pageController.DeletePage)
+		protected.POST("/pages/:id/elements/batch", can(policy.Edit, page), elementController.BatchElements)
+		protected.PUT("/pages/:id/elements/order", can(policy.Edit, page), elementController.ReorderElements)
+		protected.POST("/pages/:id/elements/group", can(policy.Edit, page), elementController.GroupElements)
+
+		// Component routes
+		protected.POST("/projects/:id/components", can(policy.Edit, project), componentController.CreateComponent)
+		protected.GET("/projects/:id/components", can(policy.View, project), componentController.GetComponents)
+		protected.GET("/components/:id", can(policy.View, component), componentController.GetComponent)
+		protected.PUT("/components/:id", can(policy.Edit, component), componentController.UpdateComponent)
+		protected.DELETE("/components/:id", can(policy.Edit, component), componentController.DeleteComponent)
+
+		protected.POST("/elements", can(policy.Edit, middleware.Body("page_id", policy.Page)), elementController.CreateElement)
+	protected.GET("/elements/:id", can(policy.View, element), elementController.GetElement)
+	protected.PUT("/elements/:id", can(policy.Edit, element), elementController.UpdateElement)
+	protected.DELETE("/elements/:id", can(policy.Edit, element), elementController.DeleteElement)
+	protected.POST("/elements/:id/reparent", can(policy.Edit, element), elementController.ReparentElement)
+	protected.POST("/elements/:id/ungroup", can(policy.Edit, element), elementController.UngroupElement)
+	protected.POST("/elements/:id/duplicate", can(policy.View, element), elementController.DuplicateElement)
+	protected.POST("/elements/:id/detach", can(policy.Edit, element), componentController.DetachInstance)
+	protected.GET("/elements", can(policy.View, middleware.Query("page_id", policy.Page)), elementController.ListElements)
+		protected.GET("/element-types", elementController.ListElementTypes)
+
+		protected.POST("/ws/ticket", wsController.IssueTicket)
 	}
 }
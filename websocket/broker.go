@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+)
+
+// Broker carries room broadcasts between hub instances so clients connected
+// to different replicas see each other's events. Every published message is
+// delivered to every subscriber, including the publishing hub.
+type Broker interface {
+	Publish(data []byte) error
+	Subscribe() (<-chan []byte, error)
+	Close() error
+}
+
+var ErrBrokerClosed = errors.New("broker closed")
+
+// MemoryBroker is an in-process Broker. It is the default for a single
+// instance and lets several hubs share one process.
+type MemoryBroker struct {
+	mu          sync.Mutex
+	subscribers []*memorySubscriber
+	closed      bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	for _, sub := range b.subscribers {
+		sub.push(data)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe() (<-chan []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	sub := newMemorySubscriber()
+	b.subscribers = append(b.subscribers, sub)
+	return sub.out, nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, sub := range b.subscribers {
+		sub.close()
+	}
+	return nil
+}
+
+// memorySubscriber queues messages without bounds so a publisher never
+// blocks on a hub that is itself busy publishing.
+type memorySubscriber struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  [][]byte
+	closed bool
+	out    chan []byte
+	done   chan struct{}
+}
+
+func newMemorySubscriber() *memorySubscriber {
+	sub := &memorySubscriber{out: make(chan []byte), done: make(chan struct{})}
+	sub.cond = sync.NewCond(&sub.mu)
+	go sub.pump()
+	return sub
+}
+
+func (s *memorySubscriber) push(data []byte) {
+	s.mu.Lock()
+	s.queue = append(s.queue, data)
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+func (s *memorySubscriber) close() {
+	s.mu.Lock()
+	s.closed = true
+	close(s.done)
+	s.mu.Unlock()
+	s.cond.Signal()
+}
+
+func (s *memorySubscriber) pump() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		data := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.out <- data:
+		case <-s.done:
+			return
+		}
+	}
+}
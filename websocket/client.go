@@ -0,0 +1,280 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type Client struct {
+	ID     string
+	Conn   *websocket.Conn
+	UserID string
+	Send   chan []byte
+
+	mu        sync.RWMutex
+	rooms     map[string]bool
+	marks     map[string]time.Time
+	closeCode int
+}
+
+// NewClient wraps an upgraded connection for the given user.
+func NewClient(id string, conn *websocket.Conn, userID string, config Config) *Client {
+	return &Client{
+		ID:     id,
+		Conn:   conn,
+		UserID: userID,
+		Send:   make(chan []byte, config.SendBuffer),
+	}
+}
+
+// InRoom reports whether the client has joined room.
+func (c *Client) InRoom(room string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rooms[room]
+}
+
+// Due reports whether interval has passed since it last returned true for
+// key on this client, so handlers can rate-limit per-connection work.
+func (c *Client) Due(key string, interval time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if last, ok := c.marks[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+	if c.marks == nil {
+		c.marks = make(map[string]time.Time)
+	}
+	c.marks[key] = now
+	return true
+}
+
+// setRoom records joining or leaving room, reporting whether that changed
+// anything.
+func (c *Client) setRoom(room string, joined bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rooms == nil {
+		c.rooms = make(map[string]bool)
+	}
+	if c.rooms[room] == joined {
+		return false
+	}
+	if joined {
+		c.rooms[room] = true
+	} else {
+		delete(c.rooms, room)
+	}
+	return true
+}
+
+// leave takes the client out of room and runs the leave hooks, unless it
+// already left.
+func (c *Client) leave(hub *Hub, room string) bool {
+	if !c.setRoom(room, false) {
+		return false
+	}
+	select {
+	case hub.Unsubscribe <- &Subscription{Client: c, Room: room}:
+	case <-hub.done:
+	}
+	for _, hook := range hub.leaveHooks {
+		hook(c, room)
+	}
+	return true
+}
+
+// evict takes the client out of a room it may no longer join and tells it
+// so.
+func (c *Client) evict(hub *Hub, room string) {
+	if !c.leave(hub, room) {
+		return
+	}
+	env, _ := NewEnvelope(TypeRevoked, nil)
+	switch kind, id, _ := ParseRoom(room); kind {
+	case "project":
+		env.ProjectID = id
+	case "team":
+		env.TeamID = id
+	}
+	c.reply(hub, env)
+}
+
+func (c *Client) roomList() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// reply queues a frame for this client only.
+func (c *Client) reply(hub *Hub, env *Envelope) {
+	hub.Post(&Message{Envelope: env, Target: c})
+}
+
+func (c *Client) ack(hub *Hub, clientSeq uint64, result interface{}) {
+	env, err := NewEnvelope(TypeAck, result)
+	if err != nil {
+		c.fail(hub, clientSeq, NewError(ErrInternal, "failed to encode result"))
+		return
+	}
+	env.ClientSeq = clientSeq
+	c.reply(hub, env)
+}
+
+func (c *Client) fail(hub *Hub, clientSeq uint64, err error) {
+	var protoErr *Error
+	if !errors.As(err, &protoErr) {
+		log.Printf("WebSocket handler error: %v", err)
+		protoErr = NewError(ErrInternal, "internal server error")
+	}
+	env, _ := NewEnvelope(TypeError, protoErr)
+	env.ClientSeq = clientSeq
+	c.reply(hub, env)
+}
+
+func (c *Client) dispatch(hub *Hub, env *Envelope) (interface{}, error) {
+	room := env.Room()
+
+	switch env.Type {
+	case TypeSubscribe:
+		if room == "" {
+			return nil, NewError(ErrBadRequest, "project_id or team_id is required")
+		}
+		if c.InRoom(room) {
+			return nil, nil
+		}
+		if hub.Authorize == nil || !hub.Authorize(c.UserID, room) {
+			return nil, NewError(ErrForbidden, "access to room denied")
+		}
+
+		sub := &Subscription{Client: c, Room: room, Result: make(chan SubscribeResult, 1)}
+		if len(env.Payload) > 0 {
+			var resume ResumeRequest
+			if err := env.Decode(&resume); err != nil {
+				return nil, err
+			}
+			if resume.Epoch != "" {
+				sub.Resume = &resume
+			}
+		}
+
+		var result SubscribeResult
+		select {
+		case hub.Subscribe <- sub:
+			result = <-sub.Result
+		case <-hub.done:
+			return nil, NewError(ErrInternal, "server is shutting down")
+		}
+		c.setRoom(room, true)
+		for _, hook := range hub.joinHooks {
+			hook(c, room)
+		}
+		return result, nil
+	case TypeUnsubscribe:
+		if room == "" {
+			return nil, NewError(ErrBadRequest, "project_id or team_id is required")
+		}
+		c.leave(hub, room)
+		return nil, nil
+	}
+
+	handler, ok := hub.handlers[env.Type]
+	if !ok {
+		return nil, NewError(ErrUnknownType, "unknown message type "+env.Type)
+	}
+	if room != "" && !c.InRoom(room) {
+		return nil, NewError(ErrForbidden, "subscribe to the room first")
+	}
+	return handler(c, env)
+}
+
+func (c *Client) ReadPump(hub *Hub) {
+	defer func() {
+		select {
+		case hub.Unregister <- c:
+		case <-hub.done:
+		}
+		c.Conn.Close()
+		// The hub already dropped the client from its rooms; a concurrent
+		// eviction may have run the hooks for some of them
+		for _, room := range c.roomList() {
+			if !c.setRoom(room, false) {
+				continue
+			}
+			for _, hook := range hub.leaveHooks {
+				hook(c, room)
+			}
+		}
+	}()
+
+	c.Conn.SetReadLimit(hub.Config.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(hub.Config.PongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(hub.Config.PongWait))
+	})
+
+	for {
+		_, message, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("WebSocket read error: %v", err)
+			}
+			break
+		}
+
+		env, err := ParseEnvelope(message)
+		if err != nil {
+			var clientSeq uint64
+			if env != nil {
+				clientSeq = env.ClientSeq
+			}
+			c.fail(hub, clientSeq, err)
+			continue
+		}
+
+		result, err := c.dispatch(hub, env)
+		if err != nil {
+			c.fail(hub, env.ClientSeq, err)
+			continue
+		}
+		c.ack(hub, env.ClientSeq, result)
+	}
+}
+
+func (c *Client) WritePump(hub *Hub) {
+	ticker := time.NewTicker(hub.Config.PingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(hub.Config.WriteWait))
+			if !ok {
+				// The hub closed the channel
+				c.Conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(c.closeCode, ""))
+				return
+			}
+			if err := c.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(hub.Config.WriteWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDue(t *testing.T) {
+	client := NewClient("c", nil, "user", DefaultConfig())
+	if !client.Due("a", time.Hour) {
+		t.Fatal("first call was not due")
+	}
+	if client.Due("a", time.Hour) {
+		t.Fatal("second call within the interval was due")
+	}
+	if !client.Due("b", time.Hour) {
+		t.Fatal("keys are not tracked separately")
+	}
+	if !client.Due("a", 0) {
+		t.Fatal("call after the interval was not due")
+	}
+}
@@ -0,0 +1,36 @@
+package websocket
+
+import "time"
+
+// Config controls connection keepalive and limits.
+type Config struct {
+	// WriteWait is the time allowed to write a frame to the peer.
+	WriteWait time.Duration
+	// PongWait is the time allowed to read the next pong from the peer.
+	PongWait time.Duration
+	// PingPeriod is how often pings are sent; it must be less than PongWait.
+	PingPeriod time.Duration
+	// MaxMessageSize is the largest frame accepted from the peer, in bytes.
+	MaxMessageSize int64
+	// SendBuffer is the number of frames queued per client before it is
+	// considered too slow and dropped.
+	SendBuffer int
+	// ReplayBuffer is the number of recent frames kept per room for clients
+	// resuming after a reconnect.
+	ReplayBuffer int
+	// ReplayTTL is how long a room's replay log outlives its last local
+	// member.
+	ReplayTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		WriteWait:      10 * time.Second,
+		PongWait:       60 * time.Second,
+		PingPeriod:     54 * time.Second,
+		MaxMessageSize: 64 * 1024,
+		SendBuffer:     256,
+		ReplayBuffer:   256,
+		ReplayTTL:      10 * time.Minute,
+	}
+}
@@ -1,34 +1,217 @@
 package websocket
 
 import (
+	"context"
+	"encoding/json"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-type Client struct {
-	Conn   *websocket.Conn
-	UserID string
-	Send   chan []byte
+const (
+	projectRoomPrefix = "project:"
+	teamRoomPrefix    = "team:"
+)
+
+// replaySweepInterval is how often the replay logs of rooms left empty for
+// longer than Config.ReplayTTL are dropped.
+const replaySweepInterval = time.Minute
+
+// ProjectRoom returns the room key for everyone editing a project.
+func ProjectRoom(projectID string) string {
+	return projectRoomPrefix + projectID
+}
+
+// TeamRoom returns the room key for team-wide notifications.
+func TeamRoom(teamID string) string {
+	return teamRoomPrefix + teamID
+}
+
+// ParseRoom splits a room key into its kind ("project" or "team") and ID.
+func ParseRoom(room string) (kind string, id string, ok bool) {
+	switch {
+	case strings.HasPrefix(room, projectRoomPrefix):
+		return "project", strings.TrimPrefix(room, projectRoomPrefix), true
+	case strings.HasPrefix(room, teamRoomPrefix):
+		return "team", strings.TrimPrefix(room, teamRoomPrefix), true
+	}
+	return "", "", false
+}
+
+// RoomAuthorizer reports whether a user may join a room.
+type RoomAuthorizer func(userID string, room string) bool
+
+// RoomHook observes a client entering or leaving a room. Hooks run on the
+// client's read goroutine, or on a hub goroutine when a client is evicted
+// by Reauthorize.
+type RoomHook func(c *Client, room string)
+
+// Message is an envelope addressed to a room or, when Target is set, to a
+// single client. When Sender is set the hub only delivers it if the sender
+// is a member of the room; Except is skipped during fan-out. Ephemeral
+// messages are neither sequenced nor kept for replay. A Reauthorize message
+// carries no envelope and re-checks the room's members instead.
+type Message struct {
+	Room        string
+	Envelope    *Envelope
+	Sender      *Client
+	Except      *Client
+	Target      *Client
+	Ephemeral   bool
+	Reauthorize bool
+}
+
+type Subscription struct {
+	Client *Client
+	Room   string
+	// Resume, if set, asks for the frames the client missed since it was
+	// last connected. The outcome is sent on Result when it is not nil.
+	Resume *ResumeRequest
+	Result chan SubscribeResult
 }
 
 type Hub struct {
-	Clients    map[*Client]bool
-	Broadcast  chan []byte
-	Register   chan *Client
-	Unregister chan *Client
+	Clients     map[*Client]bool
+	Rooms       map[string]map[*Client]bool
+	Broadcast   chan *Message
+	Register    chan *Client
+	Unregister  chan *Client
+	Subscribe   chan *Subscription
+	Unsubscribe chan *Subscription
+	Authorize   RoomAuthorizer
+	Config      Config
+	Epoch       string
+
+	handlers   map[string]HandlerFunc
+	joinHooks  []RoomHook
+	leaveHooks []RoomHook
+	seqs       map[string]uint64
+	logs       map[string]*eventLog
+	// idle records when each room with a replay log lost its last local
+	// member. seqFloor is past the highest sequence of any dropped room;
+	// rooms start from it so a resume against a dropped log cannot match.
+	idle     map[string]time.Time
+	seqFloor uint64
+	broker   Broker
+	inbound  <-chan []byte
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	writers  sync.WaitGroup
 }
 
-func NewHub() *Hub {
+func NewHub(config Config) *Hub {
 	return &Hub{
-		Broadcast:  make(chan []byte),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Clients:    make(map[*Client]bool),
+		Broadcast:   make(chan *Message, 256),
+		Register:    make(chan *Client),
+		Unregister:  make(chan *Client),
+		Subscribe:   make(chan *Subscription),
+		Unsubscribe: make(chan *Subscription),
+		Clients:     make(map[*Client]bool),
+		Rooms:       make(map[string]map[*Client]bool),
+		Config:      config,
+		Epoch:       newEpoch(),
+		handlers:    make(map[string]HandlerFunc),
+		seqs:        make(map[string]uint64),
+		logs:        make(map[string]*eventLog),
+		idle:        make(map[string]time.Time),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
 	}
 }
 
+// Handle registers the handler for a client message type. It must be called
+// before clients connect.
+func (h *Hub) Handle(msgType string, handler HandlerFunc) {
+	h.handlers[msgType] = handler
+}
+
+// OnJoin registers a hook called after a client subscribes to a room.
+func (h *Hub) OnJoin(hook RoomHook) {
+	h.joinHooks = append(h.joinHooks, hook)
+}
+
+// OnLeave registers a hook called after a client leaves a room, including
+// leaving every room on disconnect.
+func (h *Hub) OnLeave(hook RoomHook) {
+	h.leaveHooks = append(h.leaveHooks, hook)
+}
+
+// Publish sends a server event to every client in room.
+func (h *Hub) Publish(room string, msgType string, payload interface{}) {
+	env, err := NewEnvelope(msgType, payload)
+	if err != nil {
+		log.Printf("Failed to marshal %s event: %v", msgType, err)
+		return
+	}
+	h.Post(&Message{Room: room, Envelope: env})
+}
+
+// Reauthorize re-checks every member of rooms against Authorize, on every
+// instance, and evicts those who may no longer join. Call it after a change
+// that can take away access, such as removing a team member.
+func (h *Hub) Reauthorize(rooms ...string) {
+	for _, room := range rooms {
+		h.Post(&Message{Room: room, Reauthorize: true})
+	}
+}
+
+// UseBroker routes room broadcasts through broker so that hubs on other
+// instances deliver them too. It must be called before Run.
+func (h *Hub) UseBroker(broker Broker) error {
+	inbound, err := broker.Subscribe()
+	if err != nil {
+		return err
+	}
+	h.broker = broker
+	h.inbound = inbound
+	return nil
+}
+
+// brokerMessage is the wire form of a room broadcast between instances.
+type brokerMessage struct {
+	Room        string    `json:"room"`
+	Except      string    `json:"except,omitempty"`
+	Ephemeral   bool      `json:"ephemeral,omitempty"`
+	Reauthorize bool      `json:"reauthorize,omitempty"`
+	Envelope    *Envelope `json:"envelope,omitempty"`
+}
+
+// Post queues a message for delivery. It is dropped once the hub stopped.
+func (h *Hub) Post(message *Message) {
+	select {
+	case h.Broadcast <- message:
+	case <-h.done:
+	}
+}
+
+// Serve registers a freshly upgraded client and starts its pumps.
+func (h *Hub) Serve(client *Client) {
+	select {
+	case h.Register <- client:
+	case <-h.done:
+		client.Conn.Close()
+		return
+	}
+
+	h.writers.Add(1)
+	go func() {
+		defer h.writers.Done()
+		client.WritePump(h)
+	}()
+	go client.ReadPump(h)
+}
+
 func (h *Hub) Run() {
+	defer close(h.done)
+
+	sweep := time.NewTicker(replaySweepInterval)
+	defer sweep.Stop()
+
 	for {
 		select {
 		case client := <-h.Register:
@@ -36,43 +219,286 @@ func (h *Hub) Run() {
 			log.Printf("Client connected. Total clients: %d", len(h.Clients))
 		case client := <-h.Unregister:
 			if _, ok := h.Clients[client]; ok {
-				delete(h.Clients, client)
-				close(client.Send)
+				h.removeClient(client, websocket.CloseNormalClosure)
 				log.Printf("Client disconnected. Total clients: %d", len(h.Clients))
 			}
+		case sub := <-h.Subscribe:
+			h.subscribe(sub)
+		case sub := <-h.Unsubscribe:
+			h.leaveRoom(sub.Client, sub.Room)
 		case message := <-h.Broadcast:
-			log.Printf("Broadcasting message to %d clients", len(h.Clients))
-			for client := range h.Clients {
-				select {
-				case client.Send <- message:
-					// Message sent successfully
-				default:
-					close(client.Send)
-					delete(h.Clients, client)
-					log.Println("Client disconnected due to slow connection")
-				}
+			h.deliver(message)
+		case data, ok := <-h.inbound:
+			if !ok {
+				log.Println("WebSocket broker subscription closed")
+				h.inbound = nil
+				continue
 			}
+			var message brokerMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				log.Printf("Failed to decode broker message: %v", err)
+				continue
+			}
+			h.receive(message)
+		case now := <-sweep.C:
+			h.dropIdleLogs(now)
+		case <-h.stop:
+			h.shutdown()
+			return
 		}
 	}
 }
 
-func (c *Client) ReadPump(hub *Hub) {
-	for {
-		_, message, err := c.Conn.ReadMessage()
+// subscribe adds the client to the room and, for a resuming client, replays
+// the frames it missed before anything else is sent to the room.
+func (h *Hub) subscribe(sub *Subscription) {
+	result := SubscribeResult{Epoch: h.Epoch, ServerSeq: h.roomSeq(sub.Room)}
+	defer func() {
+		if sub.Result != nil {
+			sub.Result <- result
+		}
+	}()
+
+	if _, ok := h.Clients[sub.Client]; !ok {
+		return
+	}
+	if h.Rooms[sub.Room] == nil {
+		h.Rooms[sub.Room] = make(map[*Client]bool)
+	}
+	h.Rooms[sub.Room][sub.Client] = true
+	delete(h.idle, sub.Room)
+	if h.logs[sub.Room] == nil {
+		h.logs[sub.Room] = newEventLog(h.Config.ReplayBuffer)
+	}
+
+	if sub.Resume == nil {
+		return
+	}
+
+	frames, ok := h.logs[sub.Room].since(sub.Resume.LastSeq, result.ServerSeq)
+	if sub.Resume.Epoch != h.Epoch || !ok {
+		result.ResyncRequired = true
+		env, _ := NewEnvelope(TypeResync, result)
+		data, err := json.Marshal(env)
+		if err == nil {
+			h.send(sub.Client, data)
+		}
+		return
+	}
+
+	for _, data := range frames {
+		if !h.Clients[sub.Client] {
+			return
+		}
+		h.send(sub.Client, data)
+	}
+	result.Replayed = len(frames)
+}
+
+// Stop delivers any queued messages, closes every client with a close frame
+// and waits for their writers to finish or ctx to expire.
+func (h *Hub) Stop(ctx context.Context) error {
+	h.stopOnce.Do(func() { close(h.stop) })
+
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) shutdown() {
+	// Broker echoes are no longer read, so deliver what is left locally
+	h.broker = nil
+	for drained := false; !drained; {
+		select {
+		case message := <-h.Broadcast:
+			h.deliver(message)
+		default:
+			drained = true
+		}
+	}
+
+	for client := range h.Clients {
+		h.removeClient(client, websocket.CloseGoingAway)
+	}
+	log.Println("WebSocket hub stopped")
+}
+
+func (h *Hub) deliver(message *Message) {
+	if message.Target != nil {
+		if _, ok := h.Clients[message.Target]; !ok {
+			return
+		}
+		data, err := json.Marshal(message.Envelope)
 		if err != nil {
-			hub.Unregister <- c
-			c.Conn.Close()
-			break
+			log.Printf("Failed to marshal message: %v", err)
+			return
 		}
-		hub.Broadcast <- message
+		h.send(message.Target, data)
+		return
+	}
+
+	if message.Sender != nil && !h.Rooms[message.Room][message.Sender] {
+		return
+	}
+
+	var except string
+	if message.Except != nil {
+		except = message.Except.ID
+	}
+
+	out := brokerMessage{
+		Room:        message.Room,
+		Except:      except,
+		Ephemeral:   message.Ephemeral,
+		Reauthorize: message.Reauthorize,
+		Envelope:    message.Envelope,
+	}
+	if h.broker == nil {
+		h.receive(out)
+		return
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return
+	}
+	if err := h.broker.Publish(data); err != nil {
+		// Keep local clients up to date even if other instances miss out
+		log.Printf("Failed to publish to broker: %v", err)
+		h.receive(out)
 	}
 }
 
-func (c *Client) WritePump() {
-	for msg := range c.Send {
-		if err := c.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-			break
+// receive handles a room message published by this or another instance.
+func (h *Hub) receive(message brokerMessage) {
+	if message.Reauthorize {
+		h.reauthorize(message.Room)
+		return
+	}
+	h.fanOut(message.Room, message.Envelope, message.Except, message.Ephemeral)
+}
+
+// reauthorize evicts the local members of room that Authorize now denies.
+// The checks query the database, so they run off the hub goroutine.
+func (h *Hub) reauthorize(room string) {
+	members := make([]*Client, 0, len(h.Rooms[room]))
+	for client := range h.Rooms[room] {
+		members = append(members, client)
+	}
+	if len(members) == 0 {
+		return
+	}
+
+	go func() {
+		for _, client := range members {
+			if h.Authorize != nil && h.Authorize(client.UserID, room) {
+				continue
+			}
+			client.evict(h, room)
 		}
+	}()
+}
+
+// fanOut stamps env with the room's next sequence number, records it in the
+// room's replay log and sends it to every local member of the room except
+// the client with ID except. Ephemeral frames skip the first two steps.
+func (h *Hub) fanOut(room string, env *Envelope, except string, ephemeral bool) {
+	members := h.Rooms[room]
+	events := h.logs[room]
+	if len(members) == 0 && (events == nil || ephemeral) {
+		return
+	}
+
+	if !ephemeral {
+		h.seqs[room] = h.roomSeq(room) + 1
+		env.ServerSeq = h.seqs[room]
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return
+	}
+	if events != nil && !ephemeral {
+		events.append(env.ServerSeq, data)
+	}
+
+	for client := range members {
+		if except != "" && client.ID == except {
+			continue
+		}
+		h.send(client, data)
+	}
+}
+
+func (h *Hub) send(client *Client, data []byte) {
+	select {
+	case client.Send <- data:
+		// Message sent successfully
+	default:
+		h.removeClient(client, websocket.ClosePolicyViolation)
+		log.Println("Client disconnected due to slow connection")
+	}
+}
+
+// roomSeq returns the last sequence number sent to room.
+func (h *Hub) roomSeq(room string) uint64 {
+	if seq, ok := h.seqs[room]; ok {
+		return seq
+	}
+	return h.seqFloor
+}
+
+func (h *Hub) leaveRoom(client *Client, room string) {
+	if members, ok := h.Rooms[room]; ok {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(h.Rooms, room)
+			h.idle[room] = time.Now()
+		}
+	}
+}
+
+// dropIdleLogs forgets the replay logs and sequence numbers of rooms that
+// have had no local member for Config.ReplayTTL. Clients resuming in them
+// afterwards are told to resync.
+func (h *Hub) dropIdleLogs(now time.Time) {
+	for room, since := range h.idle {
+		if now.Sub(since) < h.Config.ReplayTTL {
+			continue
+		}
+		// Events published while the room had no log were not sequenced,
+		// so a client resuming at the last dropped sequence may have
+		// missed some and must not match the room's next one
+		h.seqFloor = max(h.seqFloor, h.roomSeq(room)+1)
+		delete(h.seqs, room)
+		delete(h.logs, room)
+		delete(h.idle, room)
+	}
+}
+
+// removeClient drops the client from every room and closes its send queue;
+// its writer then sends a close frame with code.
+func (h *Hub) removeClient(client *Client, code int) {
+	for _, room := range client.roomList() {
+		h.leaveRoom(client, room)
 	}
-	c.Conn.Close()
+	delete(h.Clients, client)
+	client.closeCode = code
+	close(client.Send)
 }
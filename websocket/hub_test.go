@@ -0,0 +1,209 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The tests drive the hub's handlers directly, standing in for Run.
+
+func newTestClient(hub *Hub, id string) *Client {
+	client := NewClient(id, nil, "user-"+id, hub.Config)
+	hub.Clients[client] = true
+	return client
+}
+
+func join(t *testing.T, hub *Hub, client *Client, room string, resume *ResumeRequest) SubscribeResult {
+	t.Helper()
+	result := make(chan SubscribeResult, 1)
+	hub.subscribe(&Subscription{Client: client, Room: room, Resume: resume, Result: result})
+	client.setRoom(room, true)
+	return <-result
+}
+
+func leave(hub *Hub, client *Client, room string) {
+	hub.leaveRoom(client, room)
+	client.setRoom(room, false)
+}
+
+func publish(t *testing.T, hub *Hub, room string, msgType string, ephemeral bool) {
+	t.Helper()
+	env, err := NewEnvelope(msgType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.deliver(&Message{Room: room, Envelope: env, Ephemeral: ephemeral})
+}
+
+// drain returns the types of the frames queued for client.
+func drain(t *testing.T, client *Client) []string {
+	t.Helper()
+	var types []string
+	for {
+		select {
+		case data := <-client.Send:
+			var env Envelope
+			if err := json.Unmarshal(data, &env); err != nil {
+				t.Fatal(err)
+			}
+			types = append(types, env.Type)
+		default:
+			return types
+		}
+	}
+}
+
+func TestEphemeralFramesAreNotReplayed(t *testing.T) {
+	config := DefaultConfig()
+	config.ReplayBuffer = 2
+	hub := NewHub(config)
+	room := ProjectRoom("p")
+
+	watcher := newTestClient(hub, "watcher")
+	editor := newTestClient(hub, "editor")
+	join(t, hub, watcher, room, nil)
+	last := join(t, hub, editor, room, nil)
+	leave(hub, editor, room)
+
+	publish(t, hub, room, "element.changed", false)
+	for i := 0; i < 10; i++ {
+		publish(t, hub, room, "presence.cursor", true)
+	}
+	publish(t, hub, room, "element.changed", false)
+
+	if got := drain(t, watcher); len(got) != 12 {
+		t.Fatalf("member received %d frames, want 12", len(got))
+	}
+
+	result := join(t, hub, editor, room, &ResumeRequest{Epoch: hub.Epoch, LastSeq: last.ServerSeq})
+	if result.ResyncRequired {
+		t.Fatal("cursor moves evicted edits from the replay log")
+	}
+	if got := drain(t, editor); len(got) != 2 || got[0] != "element.changed" || got[1] != "element.changed" {
+		t.Fatalf("replayed %v, want the two edits", got)
+	}
+}
+
+func TestIdleRoomLogsAreDropped(t *testing.T) {
+	config := DefaultConfig()
+	config.ReplayTTL = time.Minute
+	hub := NewHub(config)
+	room := ProjectRoom("p")
+
+	client := newTestClient(hub, "c")
+	join(t, hub, client, room, nil)
+	publish(t, hub, room, "element.changed", false)
+	publish(t, hub, room, "element.changed", false)
+	last := hub.seqs[room]
+	leave(hub, client, room)
+	drain(t, client)
+
+	hub.dropIdleLogs(time.Now())
+	if hub.logs[room] == nil {
+		t.Fatal("log dropped before the TTL passed")
+	}
+	hub.dropIdleLogs(time.Now().Add(2 * time.Minute))
+	if hub.logs[room] != nil || len(hub.seqs) != 0 || len(hub.idle) != 0 {
+		t.Fatal("idle room was not forgotten")
+	}
+
+	// Events published while the room has no members are not kept, so a
+	// client that saw the whole dropped log must resync too
+	publish(t, hub, room, "element.changed", false)
+	result := join(t, hub, client, room, &ResumeRequest{Epoch: hub.Epoch, LastSeq: last})
+	if !result.ResyncRequired {
+		t.Fatal("resume at the last dropped sequence did not require a resync")
+	}
+	leave(hub, client, room)
+	drain(t, client)
+	hub.dropIdleLogs(time.Now().Add(2 * time.Minute))
+
+	// A client that saw part of the dropped log must resync, even once
+	// the room has new events
+	other := newTestClient(hub, "other")
+	join(t, hub, other, room, nil)
+	publish(t, hub, room, "element.changed", false)
+	result = join(t, hub, client, room, &ResumeRequest{Epoch: hub.Epoch, LastSeq: last - 1})
+	if !result.ResyncRequired {
+		t.Fatal("resume against a dropped log did not require a resync")
+	}
+	if result.ServerSeq <= last {
+		t.Fatalf("sequence restarted at %d, not past %d", result.ServerSeq, last)
+	}
+}
+
+// next waits for the next frame queued for client and returns its type.
+func next(t *testing.T, client *Client) string {
+	t.Helper()
+	select {
+	case data := <-client.Send:
+		var env Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatal(err)
+		}
+		return env.Type
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a frame")
+		return ""
+	}
+}
+
+func TestReauthorizeEvictsRevokedMembers(t *testing.T) {
+	hub := NewHub(DefaultConfig())
+	room := TeamRoom("t")
+
+	var mu sync.Mutex
+	allowed := map[string]bool{"user-kept": true, "user-removed": true}
+	hub.Authorize = func(userID string, room string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return allowed[userID]
+	}
+	left := make(chan string, 2)
+	hub.OnLeave(func(c *Client, room string) { left <- c.ID })
+
+	kept := newTestClient(hub, "kept")
+	removed := newTestClient(hub, "removed")
+	join(t, hub, kept, room, nil)
+	join(t, hub, removed, room, nil)
+
+	go hub.Run()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hub.Stop(ctx)
+	})
+
+	mu.Lock()
+	delete(allowed, "user-removed")
+	mu.Unlock()
+	hub.Reauthorize(room)
+
+	if got := next(t, removed); got != TypeRevoked {
+		t.Fatalf("revoked member received %q, want %q", got, TypeRevoked)
+	}
+	if removed.InRoom(room) {
+		t.Fatal("revoked member is still in the room")
+	}
+	if id := <-left; id != "removed" {
+		t.Fatalf("leave hooks ran for %s", id)
+	}
+
+	hub.Publish(room, "team_updated", nil)
+	if got := next(t, kept); got != "team_updated" {
+		t.Fatalf("remaining member received %q", got)
+	}
+	select {
+	case <-removed.Send:
+		t.Fatal("revoked member still receives room events")
+	case <-time.After(50 * time.Millisecond):
+	}
+	select {
+	case id := <-left:
+		t.Fatalf("leave hooks ran again for %s", id)
+	default:
+	}
+}
@@ -0,0 +1,142 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion is the envelope version spoken on /api/ws.
+//
+// Every frame in either direction is a JSON Envelope. Clients must send
+// "v" and "type" and a non-zero "client_seq"; the server answers each frame
+// with either an "ack" or an "error" carrying the same client_seq. Frames
+// broadcast to a room carry a "server_seq" that increases by one per room,
+// except ephemeral ones such as cursor moves, which carry none and are not
+// replayed.
+//
+// Built-in client types:
+//
+//	subscribe    join the room named by project_id or team_id; a client
+//	             reconnecting may send {"epoch", "last_seq"} as payload to
+//	             have missed frames replayed, or receive "resync_required"
+//	unsubscribe  leave that room
+//
+// A client that loses access to a room, for example when removed from the
+// team, is taken out of it and sent "access_revoked" with the room's
+// project_id or team_id.
+//
+// Further types are registered by the application through Hub.Handle.
+const ProtocolVersion = 1
+
+// Subprotocol is the WebSocket subprotocol the server selects. Browsers that
+// authenticate with a "bearer.<token>" subprotocol entry must offer it too,
+// since the handshake fails if the server picks none of the offered ones.
+const Subprotocol = "website-builder.v1"
+
+const (
+	TypeSubscribe   = "subscribe"
+	TypeUnsubscribe = "unsubscribe"
+	TypeAck         = "ack"
+	TypeError       = "error"
+	TypeRevoked     = "access_revoked"
+)
+
+// Error codes sent in the payload of an "error" frame.
+const (
+	ErrBadRequest  = "bad_request"
+	ErrBadVersion  = "unsupported_version"
+	ErrUnknownType = "unknown_type"
+	ErrForbidden   = "forbidden"
+	ErrNotFound    = "not_found"
+	ErrConflict    = "conflict"
+	ErrValidation  = "validation_failed"
+	ErrInternal    = "internal_error"
+)
+
+type Envelope struct {
+	Version   int             `json:"v"`
+	Type      string          `json:"type"`
+	ProjectID string          `json:"project_id,omitempty"`
+	TeamID    string          `json:"team_id,omitempty"`
+	PageID    string          `json:"page_id,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	ClientSeq uint64          `json:"client_seq,omitempty"`
+	ServerSeq uint64          `json:"server_seq,omitempty"`
+}
+
+// NewEnvelope builds a server frame of the given type with payload encoded
+// as JSON.
+func NewEnvelope(msgType string, payload interface{}) (*Envelope, error) {
+	env := &Envelope{Version: ProtocolVersion, Type: msgType}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		env.Payload = data
+	}
+	return env, nil
+}
+
+// Room returns the room the envelope is addressed to, if any.
+func (e *Envelope) Room() string {
+	if e.ProjectID != "" {
+		return ProjectRoom(e.ProjectID)
+	}
+	if e.TeamID != "" {
+		return TeamRoom(e.TeamID)
+	}
+	return ""
+}
+
+// Decode unmarshals the payload into v.
+func (e *Envelope) Decode(v interface{}) error {
+	if len(e.Payload) == 0 {
+		return NewError(ErrBadRequest, "payload is required")
+	}
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return NewError(ErrBadRequest, "invalid payload: "+err.Error())
+	}
+	return nil
+}
+
+// Error is a protocol-level failure reported back to the client. Details
+// optionally carries structured context such as per-field errors.
+type Error struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func NewError(code string, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ParseEnvelope decodes and validates a client frame.
+func ParseEnvelope(data []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, NewError(ErrBadRequest, "malformed JSON frame")
+	}
+	if env.Version != ProtocolVersion {
+		return &env, NewError(ErrBadVersion, fmt.Sprintf("protocol version %d is required", ProtocolVersion))
+	}
+	if env.Type == "" {
+		return &env, NewError(ErrBadRequest, "type is required")
+	}
+	if env.ClientSeq == 0 {
+		return &env, NewError(ErrBadRequest, "client_seq is required")
+	}
+	if env.ProjectID != "" && env.TeamID != "" {
+		return &env, NewError(ErrBadRequest, "project_id and team_id are mutually exclusive")
+	}
+	return &env, nil
+}
+
+// HandlerFunc processes a validated client frame. The returned value, if
+// not nil, is sent back as the ack payload.
+type HandlerFunc func(c *Client, env *Envelope) (interface{}, error)
@@ -0,0 +1,355 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	redisDialTimeout = 5 * time.Second
+	redisMaxBackoff  = 30 * time.Second
+	// redisPublishTimeout bounds a publish, connecting included. Publish
+	// runs on the hub's goroutine, so a stalled server must not hold it up.
+	redisPublishTimeout = time.Second
+	// redisPublishRetry is how long publishing is skipped after a failure
+	// before the server is tried again.
+	redisPublishRetry = time.Second
+)
+
+// errRedisUnavailable is returned by Publish while messages cannot make
+// the round trip through the server, so the hub delivers them locally.
+var errRedisUnavailable = errors.New("redis broker unavailable")
+
+// RedisBroker fans messages out through Redis PUBLISH/SUBSCRIBE on a single
+// channel. It speaks RESP directly, so any server implementing the Redis
+// protocol (Redis, KeyDB, Valkey, a local stand-in) can be used.
+type RedisBroker struct {
+	addr     string
+	password string
+	channel  string
+
+	mu       sync.Mutex
+	pub      *respConn
+	subConns map[*respConn]bool
+	// listeners counts subscriptions and live those currently receiving;
+	// a message published while one is down would never come back to it.
+	listeners int
+	live      int
+	// retryAt is when publishing may be attempted again after a failure
+	retryAt time.Time
+	closed  bool
+	done    chan struct{}
+}
+
+// NewRedisBroker connects to the server at rawURL, of the form
+// redis://[:password@]host[:port].
+func NewRedisBroker(rawURL string, channel string) (*RedisBroker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported broker URL scheme %q", u.Scheme)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	password, _ := u.User.Password()
+
+	b := &RedisBroker{
+		addr:     addr,
+		password: password,
+		channel:  channel,
+		subConns: make(map[*respConn]bool),
+		done:     make(chan struct{}),
+	}
+
+	// Fail fast on a bad address or password
+	conn, err := b.dial(redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	b.pub = conn
+	return b, nil
+}
+
+func (b *RedisBroker) dial(timeout time.Duration) (*respConn, error) {
+	netConn, err := net.DialTimeout("tcp", b.addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &respConn{conn: netConn, r: bufio.NewReader(netConn)}
+	if b.password != "" {
+		if _, err := conn.do(timeout, "AUTH", b.password); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (b *RedisBroker) Publish(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if b.live < b.listeners || time.Now().Before(b.retryAt) {
+		return errRedisUnavailable
+	}
+
+	deadline := time.Now().Add(redisPublishTimeout)
+	// Retry once on a fresh connection if the old one went stale
+	for attempt := 0; attempt < 2; attempt++ {
+		if b.pub == nil {
+			conn, err := b.dial(time.Until(deadline))
+			if err != nil {
+				b.retryAt = time.Now().Add(redisPublishRetry)
+				return err
+			}
+			b.pub = conn
+		}
+		_, err := b.pub.do(time.Until(deadline), "PUBLISH", b.channel, string(data))
+		if err == nil {
+			return nil
+		}
+		var redisErr redisError
+		if errors.As(err, &redisErr) {
+			return err
+		}
+		b.pub.conn.Close()
+		b.pub = nil
+		var netErr net.Error
+		if attempt == 1 || (errors.As(err, &netErr) && netErr.Timeout()) {
+			b.retryAt = time.Now().Add(redisPublishRetry)
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *RedisBroker) Subscribe() (<-chan []byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	out := make(chan []byte, 256)
+	b.listeners++
+	go b.listen(out)
+	return out, nil
+}
+
+// listen keeps a subscription open, reconnecting with backoff until the
+// broker is closed.
+func (b *RedisBroker) listen(out chan<- []byte) {
+	defer close(out)
+
+	backoff := time.Second
+	for {
+		err := b.receive(out)
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+		log.Printf("Redis broker subscription lost: %v; retrying in %s", err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-b.done:
+			return
+		}
+		if backoff *= 2; backoff > redisMaxBackoff {
+			backoff = redisMaxBackoff
+		}
+	}
+}
+
+func (b *RedisBroker) receive(out chan<- []byte) error {
+	conn, err := b.dial(redisDialTimeout)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		conn.conn.Close()
+		return ErrBrokerClosed
+	}
+	b.subConns[conn] = true
+	b.mu.Unlock()
+
+	live := false
+	defer func() {
+		b.mu.Lock()
+		delete(b.subConns, conn)
+		if live {
+			b.live--
+		}
+		b.mu.Unlock()
+		conn.conn.Close()
+	}()
+
+	conn.conn.SetWriteDeadline(time.Now().Add(redisDialTimeout))
+	if err := conn.write("SUBSCRIBE", b.channel); err != nil {
+		return err
+	}
+	conn.conn.SetWriteDeadline(time.Time{})
+
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 3 {
+			continue
+		}
+		kind, _ := parts[0].([]byte)
+		if string(kind) == "subscribe" && !live {
+			live = true
+			b.mu.Lock()
+			b.live++
+			b.mu.Unlock()
+			continue
+		}
+		if string(kind) != "message" {
+			continue
+		}
+		payload, _ := parts[2].([]byte)
+
+		select {
+		case out <- payload:
+		case <-b.done:
+			return ErrBrokerClosed
+		}
+	}
+}
+
+func (b *RedisBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+
+	if b.pub != nil {
+		b.pub.conn.Close()
+		b.pub = nil
+	}
+	for conn := range b.subConns {
+		conn.conn.Close()
+	}
+	return nil
+}
+
+// respConn is a minimal RESP2 client connection.
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// do sends a command and reads its reply, giving up after timeout.
+func (c *respConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.write(args...); err != nil {
+		return nil, err
+	}
+	reply, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if redisErr, ok := reply.(redisError); ok {
+		return nil, redisErr
+	}
+	return reply, nil
+}
+
+func (c *respConn) write(args ...string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// read decodes one reply: simple strings as string, errors as redisError,
+// integers as int64, bulk strings as []byte and arrays as []interface{}.
+func (c *respConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	body := line[1 : len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return redisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply type %q", line[0])
+}
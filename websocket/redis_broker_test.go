@@ -0,0 +1,286 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process stand-in for a Redis server that supports
+// AUTH, SUBSCRIBE and PUBLISH.
+type fakeRedis struct {
+	t        *testing.T
+	listener net.Listener
+	password string
+
+	mu          sync.Mutex
+	subscribers map[*respConn]string
+	conns       map[net.Conn]bool
+	// stall leaves PUBLISH unanswered, as a server that stopped responding
+	stall bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{
+		t:           t,
+		listener:    listener,
+		password:    password,
+		subscribers: make(map[*respConn]string),
+		conns:       make(map[net.Conn]bool),
+	}
+	go s.serve()
+	t.Cleanup(s.close)
+	return s
+}
+
+func (s *fakeRedis) url() string {
+	if s.password == "" {
+		return "redis://" + s.listener.Addr().String()
+	}
+	return "redis://:" + s.password + "@" + s.listener.Addr().String()
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[netConn] = true
+		s.mu.Unlock()
+		go s.handle(&respConn{conn: netConn, r: bufio.NewReader(netConn)})
+	}
+}
+
+func (s *fakeRedis) handle(conn *respConn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, conn)
+		delete(s.conns, conn.conn)
+		s.mu.Unlock()
+		conn.conn.Close()
+	}()
+
+	authed := s.password == ""
+	for {
+		request, err := conn.read()
+		if err != nil {
+			return
+		}
+		parts, _ := request.([]interface{})
+		args := make([]string, len(parts))
+		for i, part := range parts {
+			b, _ := part.([]byte)
+			args[i] = string(b)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		switch {
+		case args[0] == "AUTH" && len(args) == 2:
+			if args[1] != s.password {
+				conn.conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+				continue
+			}
+			authed = true
+			conn.conn.Write([]byte("+OK\r\n"))
+		case !authed:
+			conn.conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+		case args[0] == "SUBSCRIBE" && len(args) == 2:
+			s.mu.Lock()
+			s.subscribers[conn] = args[1]
+			s.mu.Unlock()
+			conn.conn.Write([]byte("*3\r\n$9\r\nsubscribe\r\n$" + strconv.Itoa(len(args[1])) + "\r\n" + args[1] + "\r\n:1\r\n"))
+		case args[0] == "PUBLISH" && len(args) == 3:
+			s.mu.Lock()
+			if s.stall {
+				s.mu.Unlock()
+				continue
+			}
+			receivers := 0
+			for sub, channel := range s.subscribers {
+				if channel == args[1] {
+					sub.write("message", args[1], args[2])
+					receivers++
+				}
+			}
+			s.mu.Unlock()
+			conn.conn.Write([]byte(":" + strconv.Itoa(receivers) + "\r\n"))
+		default:
+			conn.conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+// dropSubscribers disconnects every subscribed connection.
+func (s *fakeRedis) dropSubscribers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers {
+		sub.conn.Close()
+		delete(s.subscribers, sub)
+	}
+}
+
+func (s *fakeRedis) setStall(stall bool) {
+	s.mu.Lock()
+	s.stall = stall
+	s.mu.Unlock()
+}
+
+func (s *fakeRedis) close() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func newTestBroker(t *testing.T, server *fakeRedis) (*RedisBroker, <-chan []byte) {
+	t.Helper()
+	broker, err := NewRedisBroker(server.url(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { broker.Close() })
+	inbound, err := broker.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return broker, inbound
+}
+
+// publishWhenLive publishes data once the broker's subscription is up.
+func publishWhenLive(t *testing.T, broker *RedisBroker, data string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := broker.Publish([]byte(data))
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, errRedisUnavailable) || time.Now().After(deadline) {
+			t.Fatalf("Publish: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receive(t *testing.T, inbound <-chan []byte) string {
+	t.Helper()
+	select {
+	case data := <-inbound:
+		return string(data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return ""
+	}
+}
+
+func TestRedisBrokerRoundTrip(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	first, firstInbound := newTestBroker(t, server)
+	_, secondInbound := newTestBroker(t, server)
+
+	publishWhenLive(t, first, `{"room":"project:1"}`)
+	for _, inbound := range []<-chan []byte{firstInbound, secondInbound} {
+		if got := receive(t, inbound); got != `{"room":"project:1"}` {
+			t.Errorf("received %q", got)
+		}
+	}
+}
+
+func TestRedisBrokerWrongPassword(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	if _, err := NewRedisBroker("redis://:wrong@"+server.listener.Addr().String(), "test"); err == nil {
+		t.Fatal("NewRedisBroker succeeded with a wrong password")
+	}
+}
+
+func TestRedisBrokerUnavailableWhileResubscribing(t *testing.T) {
+	server := newFakeRedis(t, "")
+	broker, inbound := newTestBroker(t, server)
+	publishWhenLive(t, broker, "before")
+	receive(t, inbound)
+
+	server.dropSubscribers()
+	// Until the subscription is back, the message could not come back to
+	// this hub, so Publish must fail for the hub to deliver it locally
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := broker.Publish([]byte("lost"))
+		if errors.Is(err, errRedisUnavailable) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Publish kept succeeding while the subscription was down")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	publishWhenLive(t, broker, "after")
+	for {
+		if got := receive(t, inbound); got == "after" {
+			break
+		}
+	}
+}
+
+func TestRedisBrokerStalledPublish(t *testing.T) {
+	server := newFakeRedis(t, "")
+	broker, _ := newTestBroker(t, server)
+	publishWhenLive(t, broker, "warm up")
+
+	server.setStall(true)
+	start := time.Now()
+	if err := broker.Publish([]byte("stalled")); err == nil {
+		t.Fatal("Publish succeeded against a stalled server")
+	}
+	if elapsed := time.Since(start); elapsed > redisPublishTimeout+500*time.Millisecond {
+		t.Fatalf("Publish blocked for %s", elapsed)
+	}
+
+	// Right after a failure the server is not tried again
+	start = time.Now()
+	if err := broker.Publish([]byte("skipped")); !errors.Is(err, errRedisUnavailable) {
+		t.Fatalf("Publish after failure = %v, want errRedisUnavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("Publish after failure blocked for %s", elapsed)
+	}
+
+	server.setStall(false)
+	time.Sleep(redisPublishRetry)
+	publishWhenLive(t, broker, "recovered")
+}
+
+func TestRedisBrokerClosed(t *testing.T) {
+	server := newFakeRedis(t, "")
+	broker, inbound := newTestBroker(t, server)
+	broker.Close()
+	if err := broker.Publish([]byte("x")); !errors.Is(err, ErrBrokerClosed) {
+		t.Fatalf("Publish after Close = %v, want ErrBrokerClosed", err)
+	}
+	select {
+	case _, ok := <-inbound:
+		if ok {
+			t.Fatal("received a message after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription was not closed")
+	}
+}
@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// TypeResync tells a resuming client that the events it missed are no
+// longer available and it must reload the project state.
+const TypeResync = "resync_required"
+
+// ResumeRequest is the optional subscribe payload of a reconnecting client:
+// the epoch and last server_seq it saw for the room.
+type ResumeRequest struct {
+	Epoch   string `json:"epoch"`
+	LastSeq uint64 `json:"last_seq"`
+}
+
+// SubscribeResult is the ack payload of a subscribe frame.
+type SubscribeResult struct {
+	Epoch          string `json:"epoch"`
+	ServerSeq      uint64 `json:"server_seq"`
+	Replayed       int    `json:"replayed,omitempty"`
+	ResyncRequired bool   `json:"resync_required,omitempty"`
+}
+
+type logEntry struct {
+	seq  uint64
+	data []byte
+}
+
+// eventLog is a ring buffer of the most recent frames sent to a room.
+type eventLog struct {
+	entries []logEntry
+	start   int
+	count   int
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{entries: make([]logEntry, size)}
+}
+
+func (l *eventLog) append(seq uint64, data []byte) {
+	if len(l.entries) == 0 {
+		return
+	}
+	if l.count < len(l.entries) {
+		l.entries[(l.start+l.count)%len(l.entries)] = logEntry{seq: seq, data: data}
+		l.count++
+		return
+	}
+	l.entries[l.start] = logEntry{seq: seq, data: data}
+	l.start = (l.start + 1) % len(l.entries)
+}
+
+// since returns every frame after seq, or false if some of them were
+// already evicted.
+func (l *eventLog) since(seq uint64, current uint64) ([][]byte, bool) {
+	if seq > current {
+		return nil, false
+	}
+	if seq == current {
+		return nil, true
+	}
+	if l.count == 0 || l.entries[l.start].seq > seq+1 {
+		return nil, false
+	}
+
+	var frames [][]byte
+	for i := 0; i < l.count; i++ {
+		entry := l.entries[(l.start+i)%len(l.entries)]
+		if entry.seq > seq {
+			frames = append(frames, entry.data)
+		}
+	}
+	return frames, true
+}
+
+// newEpoch identifies this hub's sequence space. Sequence numbers are only
+// comparable within one epoch, i.e. one process lifetime on one instance.
+func newEpoch() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}